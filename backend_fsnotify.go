@@ -0,0 +1,6 @@
+//go:build !appengine && (darwin || dragonfly || freebsd || openbsd || linux || netbsd || solaris || windows)
+
+package watch
+
+// fsnotifySupported reports whether fsnotify has a backend for this platform.
+const fsnotifySupported = true
@@ -0,0 +1,7 @@
+//go:build appengine || (!darwin && !dragonfly && !freebsd && !openbsd && !linux && !netbsd && !solaris && !windows)
+
+package watch
+
+// fsnotifySupported reports whether fsnotify has a backend for this platform.
+// Where it has none, e.g. plan9 or js/wasm, watchers poll by default.
+const fsnotifySupported = false
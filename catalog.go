@@ -0,0 +1,102 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Catalog holds the message bundles of a locales directory, as loaded by
+// WatchCatalog: one file per locale, named after it, e.g. en.json or
+// pt-BR.json. It is safe for concurrent use.
+type Catalog struct {
+	bundles atomic.Pointer[map[string]map[string]string] // locale -> key -> message
+}
+
+// WatchCatalog loads the bundles of dir and loads them again whenever any of
+// them changes, until ctx is done. parse decodes a bundle into its messages
+// by key; if nil, bundles are JSON objects of strings. If any bundle fails to
+// load after a change, the error is reported to onError, if not nil, and
+// every previous bundle is kept, so that a catalog never mixes versions.
+func WatchCatalog(ctx context.Context, dir string, parse func([]byte) (map[string]string, error), onError func(error)) (*Catalog, error) {
+	if parse == nil {
+		parse = func(data []byte) (map[string]string, error) {
+			var messages map[string]string
+			err := json.Unmarshal(data, &messages)
+			return messages, err
+		}
+	}
+	cat := &Catalog{}
+	if err := cat.load(dir, parse); err != nil {
+		return nil, err
+	}
+
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.OnChange = func(context.Context, Cycle) bool {
+		if err := cat.load(dir, parse); err != nil && onError != nil {
+			onError(err)
+		}
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Halt()
+		case <-w.Done():
+		}
+	}()
+	return cat, nil
+}
+
+// load replaces the bundles of c with those of dir, unless one fails.
+func (c *Catalog) load(dir string, parse func([]byte) (map[string]string, error)) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read locales: %w", err)
+	}
+	bundles := map[string]map[string]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+		messages, err := parse(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse bundle %s: %w", name, err)
+		}
+		bundles[strings.TrimSuffix(name, filepath.Ext(name))] = messages
+	}
+	c.bundles.Store(&bundles)
+	return nil
+}
+
+// Message returns the message of key for locale.
+func (c *Catalog) Message(locale, key string) (string, bool) {
+	msg, ok := (*c.bundles.Load())[locale][key]
+	return msg, ok
+}
+
+// Locales returns the locales of the catalog, sorted.
+func (c *Catalog) Locales() []string {
+	bundles := *c.bundles.Load()
+	locales := make([]string, 0, len(bundles))
+	for locale := range bundles {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatchCatalog(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("en.json", `{"hello": "Hello"}`)
+	write("de.json", `{"hello": "Hallo"}`)
+
+	errs := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cat, err := WatchCatalog(ctx, dir, nil, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locales := cat.Locales(); !slices.Equal(locales, []string{"de", "en"}) {
+		t.Errorf("expected de and en, got %v", locales)
+	}
+	if msg, _ := cat.Message("de", "hello"); msg != "Hallo" {
+		t.Errorf("expected Hallo, got %q", msg)
+	}
+
+	// A broken bundle keeps every previous one.
+	write("de.json", `{"hello": `)
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("the broken bundle was not reported")
+	}
+	if msg, _ := cat.Message("de", "hello"); msg != "Hallo" {
+		t.Errorf("expected Hallo to be kept, got %q", msg)
+	}
+
+	write("de.json", `{"hello": "Guten Tag"}`)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if msg, _ := cat.Message("de", "hello"); msg == "Guten Tag" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the fixed bundle was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,156 @@
+package watch
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ChangeSet sorts the paths of a cycle by what happened to them, judging by
+// the events received and whether each path still exists when the cycle
+// ends. Every slice is sorted.
+type ChangeSet struct {
+	// Created are the paths that were created during the cycle and still
+	// exist.
+	Created []string `json:"created,omitempty"`
+	// Modified are the paths that existed before the cycle and still exist,
+	// and whose content may have changed.
+	Modified []string `json:"modified,omitempty"`
+	// Metadata are the paths that existed before the cycle and still exist,
+	// and of which only attributes changed, i.e. every event for them was a
+	// Chmod: permissions, ownership or, on most platforms, times, as after
+	// touch or rsync -a. Polling reports changed times as writes instead.
+	Metadata []string `json:"metadata,omitempty"`
+	// Removed are the paths that no longer exist. Paths that were created
+	// and removed again during the cycle are not in the cycle at all.
+	Removed []string `json:"removed,omitempty"`
+	// Renamed are the paths that were moved away and no longer exist, sorted
+	// by From. When the move was seen as a rename immediately followed by a
+	// create, which is how fsnotify reports moves within the watched
+	// directories on most platforms and how polling reports them on the OS
+	// filesystem, the new path is in To rather than in Created.
+	Renamed []Rename `json:"renamed,omitempty"`
+}
+
+// Rename is a path moved away during a cycle.
+type Rename struct {
+	// From is the path before the rename.
+	From string `json:"from"`
+	// To is the path after the rename, or "" if it is not known.
+	To string `json:"to,omitempty"`
+}
+
+// Paths returns every path in s, sorted. For renames, both paths are
+// included.
+func (s ChangeSet) Paths() []string {
+	paths := make([]string, 0, len(s.Created)+len(s.Modified)+len(s.Metadata)+len(s.Removed)+2*len(s.Renamed))
+	paths = append(paths, s.Created...)
+	paths = append(paths, s.Modified...)
+	paths = append(paths, s.Metadata...)
+	paths = append(paths, s.Removed...)
+	for _, r := range s.Renamed {
+		paths = append(paths, r.From)
+		if r.To != "" {
+			paths = append(paths, r.To)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// Matching returns the changes in s to paths whose base name matches the
+// filepath.Match pattern, as Config.Ignore does. A rename matches if either
+// of its paths does. A malformed pattern matches nothing.
+func (s ChangeSet) Matching(pattern string) ChangeSet {
+	match := func(path string) bool {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}
+	var m ChangeSet
+	for _, path := range s.Created {
+		if match(path) {
+			m.Created = append(m.Created, path)
+		}
+	}
+	for _, path := range s.Modified {
+		if match(path) {
+			m.Modified = append(m.Modified, path)
+		}
+	}
+	for _, path := range s.Metadata {
+		if match(path) {
+			m.Metadata = append(m.Metadata, path)
+		}
+	}
+	for _, path := range s.Removed {
+		if match(path) {
+			m.Removed = append(m.Removed, path)
+		}
+	}
+	for _, r := range s.Renamed {
+		if match(r.From) || r.To != "" && match(r.To) {
+			m.Renamed = append(m.Renamed, r)
+		}
+	}
+	return m
+}
+
+// statResult is the result of a stat.
+type statResult struct {
+	info fs.FileInfo
+	err  error
+}
+
+// changeSet sorts paths, as received with the union of their ops, by
+// whether they were created and still exist. renames maps the new paths of
+// moves to their old paths. stated has the paths already stat'ed since they
+// settled, which are not stat'ed again. If stats is not nil, the Stat of
+// each path is added to it.
+func (c Config) changeSet(paths []string, ops map[string]fsnotify.Op, renames map[string]string, stated map[string]statResult, stats map[string]Stat) ChangeSet {
+	var s ChangeSet
+	var created []string
+	for _, path := range paths {
+		op := ops[path]
+		r, ok := stated[path]
+		if !ok {
+			r.info, r.err = c.stat(path)
+		}
+		info, err := r.info, r.err
+		if stats != nil {
+			var st Stat
+			if err == nil {
+				st = Stat{Exists: true, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+			}
+			stats[path] = st
+		}
+		switch {
+		case err == nil && op.Has(fsnotify.Create):
+			created = append(created, path)
+		case err == nil && op == fsnotify.Chmod:
+			s.Metadata = append(s.Metadata, path)
+		case err == nil || !errors.Is(err, fs.ErrNotExist):
+			s.Modified = append(s.Modified, path)
+		case op.Has(fsnotify.Rename) && !op.Has(fsnotify.Create):
+			s.Renamed = append(s.Renamed, Rename{From: path})
+		default:
+			s.Removed = append(s.Removed, path)
+		}
+	}
+	// Pair the moves whose both paths ended up where expected.
+	for _, path := range created {
+		i := slices.IndexFunc(s.Renamed, func(r Rename) bool {
+			return r.To == "" && r.From == renames[path]
+		})
+		if i < 0 {
+			s.Created = append(s.Created, path)
+			continue
+		}
+		s.Renamed[i].To = path
+	}
+	slices.SortFunc(s.Renamed, func(a, b Rename) int { return strings.Compare(a.From, b.From) })
+	return s
+}
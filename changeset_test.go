@@ -0,0 +1,178 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestChangeSet(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"new.go", "old.go", "touched.go", "moved.css"} {
+		if err := os.WriteFile(path(name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ops := map[string]fsnotify.Op{
+		path("new.go"):     fsnotify.Create | fsnotify.Write,
+		path("old.go"):     fsnotify.Write,
+		path("touched.go"): fsnotify.Chmod,
+		path("gone.go"):    fsnotify.Remove,
+		path("temp.go"):    fsnotify.Create | fsnotify.Remove,
+		path("away.css"):   fsnotify.Rename,
+		path("moved.css"):  fsnotify.Create,
+	}
+	var paths []string
+	for p := range ops {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	stats := map[string]Stat{}
+	s := Config{}.changeSet(paths, ops, nil, nil, stats)
+	if !slices.Equal(s.Created, []string{path("moved.css"), path("new.go")}) {
+		t.Errorf("unexpected Created %v", s.Created)
+	}
+	if !slices.Equal(s.Modified, []string{path("old.go")}) {
+		t.Errorf("unexpected Modified %v", s.Modified)
+	}
+	if !slices.Equal(s.Metadata, []string{path("touched.go")}) {
+		t.Errorf("unexpected Metadata %v", s.Metadata)
+	}
+	if !slices.Equal(s.Removed, []string{path("gone.go"), path("temp.go")}) {
+		t.Errorf("unexpected Removed %v", s.Removed)
+	}
+	if !slices.Equal(s.Renamed, []Rename{{From: path("away.css")}}) {
+		t.Errorf("unexpected Renamed %v", s.Renamed)
+	}
+	if st := stats[path("old.go")]; !st.Exists || !st.Mode.IsRegular() || st.ModTime.IsZero() {
+		t.Errorf("unexpected Stat of old.go %+v", st)
+	}
+	if st := stats[path("gone.go")]; st != (Stat{}) {
+		t.Errorf("unexpected Stat of gone.go %+v", st)
+	}
+	if !slices.Equal(s.Paths(), paths) {
+		t.Errorf("expected Paths %v, got %v", paths, s.Paths())
+	}
+
+	css := s.Matching("*.css")
+	if !slices.Equal(css.Paths(), []string{path("away.css"), path("moved.css")}) || len(css.Modified) != 0 {
+		t.Errorf("unexpected Matching %+v", css)
+	}
+}
+
+func TestRenamePairing(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(from, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 20 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	if err := os.Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		want := []Rename{{From: from, To: to}}
+		if !slices.Equal(cycle.Changes.Renamed, want) || len(cycle.Changes.Created) != 0 {
+			t.Errorf("expected %v, got %+v", want, cycle.Changes)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the rename was not seen")
+	}
+}
+
+func TestTransientFiles(t *testing.T) {
+	dir := t.TempDir()
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 50 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	temp := func(name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	temp("a.tmp")
+	select {
+	case cycle := <-cycles:
+		t.Errorf("unexpected cycle for a transient file %+v", cycle)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	temp("b.tmp")
+	kept := filepath.Join(dir, "kept.txt")
+	if err := os.WriteFile(kept, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		if !slices.Equal(cycle.Paths, []string{kept}) || !slices.Equal(cycle.Changes.Created, []string{kept}) || len(cycle.Changes.Removed) != 0 {
+			t.Errorf("expected only %s, got %+v", kept, cycle)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the change was not seen")
+	}
+}
+
+func TestTransientFilesLegacy(t *testing.T) {
+	// The legacy Watch is still called once per debounce.
+	dir := t.TempDir()
+	called := make(chan struct{}, 10)
+	halt, err := Watch([]string{dir}, 50*time.Millisecond, nil, func() bool {
+		called <- struct{}{}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	path := filepath.Join(dir, "a.tmp")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Errorf("onchange was not called")
+	}
+}
@@ -0,0 +1,132 @@
+// Package ci runs a pipeline for every cycle of a watcher, as a local
+// continuous integration. It is a package of its own so that the watch
+// package doesn't import net/http.
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/infogulch/watch"
+)
+
+// DefaultKeep is how many runs a Pipeline keeps in its history if
+// Pipeline.Keep is not set.
+const DefaultKeep = 100
+
+// Pipeline runs a command for every cycle, as a local continuous
+// integration: a make target, act, a task runner. The output of each run is
+// written to a log file of its own, and the results are kept in a history
+// that History and ServeHTTP report. Use its OnChange as that of the
+// watch.Config watching the sources.
+type Pipeline struct {
+	// Command is the program and arguments of the pipeline, e.g.
+	// []string{"make", "check"}.
+	Command []string
+	// Dir is the directory it runs in, or the current one if empty.
+	Dir string
+	// LogDir, if not empty, is the directory the log of each run is written
+	// to, created if needed.
+	LogDir string
+	// Keep is the most runs kept in the history, along with their logs. If
+	// zero, DefaultKeep is used.
+	Keep int
+
+	mu   sync.Mutex
+	runs []Run
+}
+
+// Run is the result of a run of a Pipeline.
+type Run struct {
+	Cycle    uint64        `json:"cycle"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Passed   bool          `json:"passed"`
+	// Error is why the run failed, e.g. "exit status 2".
+	Error string `json:"error,omitempty"`
+	// Log is the path of the log file, if Pipeline.LogDir is set.
+	Log string `json:"log,omitempty"`
+}
+
+// OnChange runs the pipeline for cycle and records the result. It keeps the
+// watcher running, unless Command is empty.
+func (p *Pipeline) OnChange(ctx context.Context, cycle watch.Cycle) bool {
+	if len(p.Command) == 0 {
+		slog.Default().Error("CI pipeline has no command", "cycle", cycle.ID)
+		return false
+	}
+	run := Run{Cycle: cycle.ID, Start: time.Now()}
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Dir = p.Dir
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if p.LogDir != "" {
+		run.Log = filepath.Join(p.LogDir, fmt.Sprintf("%s-cycle%d.log", run.Start.Format("20060102-150405"), cycle.ID))
+		log, err := createLog(run.Log)
+		if err != nil {
+			slog.Default().Error("failed to create CI log", "cycle", cycle.ID, "error", err)
+			run.Log = ""
+		} else {
+			defer log.Close()
+			cmd.Stdout, cmd.Stderr = log, log
+		}
+	}
+	err := cmd.Run()
+	run.Duration = time.Since(run.Start)
+	run.Passed = err == nil
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	keep := p.Keep
+	if keep == 0 {
+		keep = DefaultKeep
+	}
+	p.mu.Lock()
+	p.runs = append(p.runs, run)
+	var dropped []Run
+	if len(p.runs) > keep {
+		dropped = slices.Clone(p.runs[:len(p.runs)-keep])
+		p.runs = slices.Delete(p.runs, 0, len(p.runs)-keep)
+	}
+	p.mu.Unlock()
+	for _, run := range dropped {
+		if run.Log == "" {
+			continue
+		}
+		if err := os.Remove(run.Log); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Default().Error("failed to remove CI log", "cycle", cycle.ID, "error", err)
+		}
+	}
+	return true
+}
+
+func createLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// History returns the runs kept, oldest first.
+func (p *Pipeline) History() []Run {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.runs)
+}
+
+// ServeHTTP serves the History as JSON.
+func (p *Pipeline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.History())
+}
@@ -0,0 +1,43 @@
+package ci
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/infogulch/watch"
+)
+
+func TestPipeline(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not installed")
+	}
+	p := &Pipeline{Command: []string{"go", "version"}, LogDir: filepath.Join(t.TempDir(), "logs"), Keep: 2}
+	for i := uint64(1); i <= 2; i++ {
+		p.OnChange(context.Background(), watch.Cycle{ID: i})
+	}
+	p.Command = []string{"go", "no-such-command"}
+	p.OnChange(context.Background(), watch.Cycle{ID: 3})
+
+	runs := p.History()
+	if len(runs) != 2 || runs[0].Cycle != 2 || runs[1].Cycle != 3 {
+		t.Fatalf("expected the runs of cycles 2 and 3, got %+v", runs)
+	}
+	if !runs[0].Passed || runs[1].Passed || runs[1].Error == "" {
+		t.Errorf("expected cycle 2 to pass and 3 to fail, got %+v", runs)
+	}
+	log, err := os.ReadFile(runs[0].Log)
+	if err != nil || len(log) == 0 {
+		t.Errorf("expected the output of the run in its log, got %q, %v", log, err)
+	}
+	if logs, _ := os.ReadDir(p.LogDir); len(logs) != 2 {
+		t.Errorf("expected the logs of the 2 runs kept, got %d", len(logs))
+	}
+
+	p.Command = nil
+	if p.OnChange(context.Background(), watch.Cycle{ID: 4}) {
+		t.Errorf("expected a pipeline without a command to stop the watcher")
+	}
+}
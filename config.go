@@ -0,0 +1,654 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config configures a watcher started with Config.Watch. Start from
+// DefaultConfig and override fields as needed; the zero value of every field
+// except Dirs and OnChange is valid.
+type Config struct {
+	// Dirs are the root directories to watch, recursively. A root can also
+	// be a file, which is watched through its directory so that it is still
+	// seen after being replaced by a rename; events for the other entries of
+	// that directory are dropped.
+	Dirs []string
+
+	// Globs are filepath.Match patterns for more roots, e.g. "projects/*",
+	// matched again every time the watch set is rebuilt. Only the last
+	// element of a pattern may have wildcards: the directory it is in is
+	// watched too, for its matching entries only, so that new matches start
+	// a cycle and are watched once it ends, and removed ones stop being
+	// watched. Ignored matches are left out.
+	Globs []string
+
+	// Debounce is how long to wait after the latest event before calling
+	// OnChange.
+	Debounce time.Duration
+
+	// Ignore is a list of filepath.Match patterns matched against the base
+	// name of every directory found while walking Dirs and every event path.
+	// Matching directories are not watched, and events for matching paths are
+	// dropped. The roots in Dirs are never ignored.
+	Ignore []string
+
+	// Filter, if not nil, drops the events whose path it does not match,
+	// after Ignore. Unlike Ignore, it does not affect which directories are
+	// watched.
+	Filter Filter
+
+	// FilterWorkers, if greater than zero, is the number of goroutines that
+	// match events against Filter, for filters that are slow, like Size or
+	// ones that hash files, so that a burst of events keeps being drained
+	// while they run. Events are still recorded in the order they arrive,
+	// and a cycle doesn't end while any is being matched.
+	FilterWorkers int
+
+	// IgnoreMetadata drops the events that only report changed attributes
+	// (fsnotify.Chmod), e.g. of chmod, chown, touch or rsync -a, so that
+	// they don't start a cycle. Without it, such paths are listed in
+	// ChangeSet.Metadata rather than Modified.
+	IgnoreMetadata bool
+
+	// Logger receives the watcher's logs. If nil, slog.Default() is used.
+	// The attributes it logs are documented on NewLogHandler, which adapts
+	// other logging libraries.
+	Logger *slog.Logger
+
+	// MaxDirs, if greater than zero, is the most directories to watch. Once
+	// it is reached, the remaining directories are neither watched nor walked,
+	// and are logged as uncovered at warn level and listed in
+	// Rescan.Uncovered, unless PollUncovered is set. Use it to keep a watcher
+	// from exhausting the system's watch limit.
+	MaxDirs int
+
+	// PollUncovered polls the directories left out because of MaxDirs, and
+	// their subdirectories, every Poll (DefaultPoll if not set), instead of
+	// not watching them at all. They are still listed in Rescan.Uncovered.
+	// It only applies where fsnotify is used.
+	PollUncovered bool
+
+	// RaiseWatchLimit raises the system's limit on watches, once, when a
+	// watch set comes close to it or fails to be established because of it,
+	// instead of only logging a warning with the command that does. It takes
+	// root, and is only supported for inotify on Linux.
+	RaiseWatchLimit bool
+
+	// AllowPartial keeps watching when some directories cannot be walked or
+	// watched, e.g. for lack of permissions or because the system's watch
+	// limit is reached. Those directories and their subtrees are left out and
+	// listed in Coverage.Failed. Without it, any such failure stops the watch
+	// set from being established, except running out of file descriptors,
+	// after which every directory is polled instead.
+	AllowPartial bool
+
+	// SameFilesystem doesn't descend into directories on other filesystems
+	// than their root, like find -xdev, e.g. to leave out a network share or
+	// a tmpfs mounted under Dirs. Those mount points are listed in
+	// Coverage.Ignored with an empty Pattern, and their files are left out
+	// of Manifest, InitialScan and Tree too. It is only supported on Unix.
+	SameFilesystem bool
+
+	// FollowSymlinks watches the targets of symlinks found under Dirs, for
+	// trees made of links into an external store. Events on a target are
+	// reported with the path through the link. Only the watch set follows
+	// links; Manifest, DiffSize and Tree do not.
+	FollowSymlinks bool
+
+	// Trace logs every event received from fsnotify at debug level with its
+	// path, op, arrival time and what the watcher did with it: "ignored" (with
+	// the matching pattern), "filtered" (with Filter), "cycle started" or
+	// "debounced".
+	Trace bool
+
+	// Poll, if greater than zero, finds changes by listing every watched
+	// directory at this interval instead of using fsnotify. Use it where
+	// fsnotify gets no events, e.g. on network mounts. With PollDirs or
+	// PollUncovered, it is only the interval for those. On platforms fsnotify
+	// does not support, e.g. plan9 or js/wasm, changes are always polled for,
+	// every DefaultPoll if Poll is not set.
+	Poll time.Duration
+
+	// PollDirs are roots, among Dirs, to poll every Poll (DefaultPoll if not
+	// set) while the others are watched with fsnotify, e.g. a network mount
+	// next to local trees. Roots on 9p mounts, like the Windows drives under
+	// /mnt in WSL2, are added with a warning unless Poll, FS or NewSource is
+	// set, as fsnotify does not see the changes made from the Windows side.
+	PollDirs []string
+
+	// FS, if not nil, is the filesystem Dirs are in, e.g. an in-memory
+	// filesystem in tests. Dirs are then slash-separated paths valid for
+	// fs.FS, and changes are found by polling every Poll (DefaultPoll if not
+	// set). Manifest, DiffSize, Tree and FollowSymlinks read the OS
+	// filesystem and can't be used with FS.
+	FS fs.FS
+
+	// Middleware are applied to every event received, in order, before
+	// Ignore, Filter and debouncing. See Middleware.
+	Middleware []Middleware
+
+	// NewSource creates the Source events are read from. If nil, an
+	// fsnotify.Watcher is used, or polling if Poll or FS is set. Directories
+	// are still found by walking Dirs.
+	NewSource func() (Source, error)
+
+	// Share, if true, uses a single fsnotify.Watcher for all watchers in the
+	// process that set it, instead of one each, and a directory watched by
+	// several of them counts once against the system's limits. Each watcher
+	// still only gets the events of its own directories. Rebuilds of the
+	// watch set then keep the directories that are still watched in place.
+	// It has no effect with Poll, FS or NewSource.
+	//
+	// Watchers that also have the same Dirs, Globs and watch settings, down
+	// to the String of their Filter, Stat and Trace, share a single loop as
+	// well, which calls the OnChange, OnRescan, OnRestart and OnError of
+	// each. This is not done if any of them has FS, NewSource, Handlers,
+	// Manifest, DiffSize, Tree, Latency, Journal, Initial, InitialScan or
+	// OnPanic set, and the Logger of the first one is used. OnChange is then
+	// called with a context that is not done when its own watcher is halted.
+	Share bool
+
+	// Reconcile, if greater than zero, rebuilds the watch set at this
+	// interval while no cycle is in progress, as a safety net against missed
+	// events for new directories, e.g. every 5 minutes for a long-running
+	// watcher. OnRescan is called after each rebuild.
+	Reconcile time.Duration
+
+	// HaltOnRemove stops the watcher once every one of Dirs has been removed,
+	// after the cycle that saw it, and makes Run return ErrRootsRemoved.
+	// Without it, the watcher keeps running and failing to rebuild the watch
+	// set. Matches of Globs are not roots for this purpose.
+	HaltOnRemove bool
+
+	// Incremental updates the watch set after each cycle for the directories
+	// created, moved or removed during it, instead of walking every root
+	// again, so that moving a large directory is cheap. The watch set is
+	// still rebuilt in full when it can't be updated this way: with
+	// FollowSymlinks or MaxDirs, when a root or a match of Globs changed,
+	// after events were lost, and with Reconcile.
+	Incremental bool
+
+	// RescanRetries, if greater than zero, is how many times to retry
+	// rebuilding the watch set when it fails, e.g. because the system is out
+	// of file descriptors for a moment. The first retry waits RescanBackoff,
+	// and every next one twice as long as the previous, up to a minute. If
+	// every retry fails, the watcher stops and Run returns the error. Without
+	// retries, the previous watch set is kept until the next rebuild.
+	RescanRetries int
+
+	// RescanBackoff is the delay before the first retry of RescanRetries. If
+	// zero, DefaultRescanBackoff is used.
+	RescanBackoff time.Duration
+
+	// Restarts, if greater than zero, is how many times in a row to replace
+	// the event source when it fails, i.e. closes its channels, e.g. after
+	// its file descriptor was revoked, instead of stopping the watcher. The
+	// first attempt waits RestartBackoff, and every next one twice as long as
+	// the previous, up to a minute. If every attempt fails, the watcher stops
+	// and Run returns the error. Changes made while no source was running are
+	// not seen. OnRestart is called after each attempt.
+	Restarts int
+
+	// RestartBackoff is the delay before the first attempt of Restarts. If
+	// zero, DefaultRestartBackoff is used.
+	RestartBackoff time.Duration
+
+	// Manifest, if not empty, is the path of a file used to detect changes
+	// made while the watcher was not running. After every call to OnChange
+	// the path, size and modification time of every watched file, as they
+	// were when OnChange was called, are saved to it. When the watcher starts
+	// and the files no longer match the manifest, OnChange is called right
+	// away without waiting for an event. If the manifest does not exist yet
+	// it is created. It may be under Dirs: its events are dropped.
+	Manifest string
+
+	// Stat makes Cycle.Stats hold the size, modification time and mode of
+	// each changed path as they were when the cycle settled, or that it no
+	// longer exists, so that OnChange doesn't have to stat them again.
+	Stat bool
+
+	// DiffSize, if greater than zero, makes Cycle.Diffs hold a unified diff
+	// for each changed text file of at most DiffSize bytes. The content of
+	// every such file is kept in memory to compute the diffs.
+	DiffSize int64
+
+	// Tree, if not nil, is built when the watcher starts and kept up to date
+	// with the content of the watched files. It is updated before each call
+	// to OnChange.
+	Tree *Tree
+
+	// Latency, if not nil, records how long each cycle takes to settle and
+	// how long OnChange takes to return.
+	Latency *Latency
+
+	// Journal, if not empty, is the path of a file that every cycle is
+	// appended to, as a line of JSON, before OnChange is called. Use Replay
+	// to call OnChange again for past cycles. It may be under Dirs: its
+	// events are dropped.
+	Journal string
+
+	// Initial calls OnChange once as soon as the watcher starts, without
+	// waiting for an event, e.g. to run the first build of a dev loop. The
+	// cycle has no Paths.
+	Initial bool
+
+	// InitialScan is like Initial, but the first cycle lists every file under
+	// Dirs and the matches of Globs as created, leaving out the ones Ignore
+	// or Filter would drop the events of, e.g. to build an index before
+	// keeping it up to date.
+	InitialScan bool
+
+	// OnReady, if not nil, is called once the initial watch set is
+	// established, before Watch returns, with what it covers. Changes made
+	// after this point are guaranteed to be seen.
+	OnReady func(Coverage)
+
+	// OnRescan, if not nil, is called after the watch set is rebuilt
+	// following each call to OnChange. Once it is called, changes are
+	// guaranteed to be seen by the next cycle.
+	OnRescan func(Rescan)
+
+	// OnRestart, if not nil, is called after each attempt to replace a failed
+	// event source, with Restarts.
+	OnRestart func(Restart)
+
+	// Timeout, if greater than zero, bounds how long OnChange may run. Once
+	// it passes, the ctx of OnChange is cancelled and the watcher goes on
+	// without waiting for it to return, as if it had returned true. An
+	// OnChange that ignores its ctx then keeps running concurrently with the
+	// next cycles.
+	Timeout time.Duration
+
+	// OnPanic, if not nil, recovers panics in OnChange, which otherwise
+	// crash the program. It is called with the value passed to panic and the
+	// stack trace of the panic; return true to keep watching, or false to
+	// stop the watcher as if OnChange had returned false.
+	OnPanic func(v any, stack []byte) bool
+
+	// OnError, if not nil, is called with an *Error for every error the
+	// watcher recovers from, which are otherwise only logged at info level.
+	OnError func(error)
+
+	// OnChange is called once the debounce delay passes with no new events.
+	// Return false to stop the watcher. ctx is cancelled when the watcher is
+	// halted.
+	OnChange func(ctx context.Context, c Cycle) bool
+
+	// Handlers are more callbacks for changes to Dirs, each with its own
+	// debounce cycles. A handler that returns false stops alone; the watcher
+	// stops once OnChange and every handler have. They all get their events
+	// from a single fsnotify.Watcher, e.g. for a fast handler that refreshes
+	// a UI and a slow one that reindexes.
+	Handlers []Handler
+
+	ignore   *ignoreMatcher // Ignore, compiled when the loop starts
+	listings *listings      // kept between the walks of the loop
+	trigger  *trigger       // of the Watcher from Start, if any
+	hub      *hub           // shared by the loops of Handlers, unless Share
+	settle   bool           // call OnChange even if every change was dropped
+}
+
+// Handler is a callback of Config.Handlers, e.g. for a step of a pipeline
+// that needs a longer debounce than the others.
+type Handler struct {
+	// Debounce is how long to wait after the latest event, not ignored by
+	// this handler, before calling OnChange.
+	Debounce time.Duration
+
+	// Ignore are more patterns, in addition to Config.Ignore, for paths this
+	// handler is not interested in.
+	Ignore []string
+
+	// Filter, if not nil, drops the events this handler is not interested
+	// in, in addition to Config.Filter.
+	Filter Filter
+
+	// Initial calls OnChange once as soon as the watcher starts.
+	Initial bool
+
+	// OnChange is like Config.OnChange. Each handler has cycles of its own.
+	OnChange func(ctx context.Context, c Cycle) bool
+}
+
+// Cycle describes one debounce cycle, from the first event until OnChange is
+// called. It encodes to JSON with stable lowercase keys, and with
+// encoding/gob, e.g. to hand it to another process.
+type Cycle struct {
+	// ID numbers the cycles of every watcher in the process, starting at 1,
+	// so that the IDs of a watcher increase but skip the cycles of the
+	// others. It matches the "cycle" attribute of the watcher's log lines.
+	ID uint64 `json:"cycle"`
+
+	// Start is when the first event of the cycle arrived, or when the cycle
+	// started without events, with Config.Initial or Config.Manifest.
+	Start time.Time `json:"start"`
+
+	// Time is when the debounce delay passed.
+	Time time.Time `json:"time"`
+
+	// Paths are the paths of the events received during the cycle, sorted and
+	// without duplicates. Ignored paths are not included, nor are the paths
+	// that were created and removed again during the cycle, like temporary
+	// files, nor FIFOs, sockets and devices. A cycle in which nothing else
+	// changed is skipped.
+	Paths []string `json:"paths"`
+
+	// Changes sorts Paths by what happened to them.
+	Changes ChangeSet `json:"changes"`
+
+	// Diffs maps the path of each changed text file to a unified diff of its
+	// changes, if Config.DiffSize is set.
+	Diffs map[string]string `json:"diffs,omitempty"`
+
+	// Stats maps each path to its Stat, if Config.Stat is set.
+	Stats map[string]Stat `json:"stats,omitempty"`
+}
+
+// Stat describes a changed path when its cycle settled, with Config.Stat.
+type Stat struct {
+	// Exists is false if the path no longer exists, in which case the other
+	// fields are zero.
+	Exists  bool        `json:"exists"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"mtime,omitempty"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+}
+
+// Rescan describes the rebuild of the watch set at the end of a cycle.
+type Rescan struct {
+	// Cycle is the ID of the cycle that triggered the rebuild, or of the
+	// latest cycle if Reconcile is set.
+	Cycle uint64
+	// Reconcile is set if the rebuild was triggered by Config.Reconcile.
+	Reconcile bool
+	// Incremental is set if, with Config.Incremental, only the directories
+	// changed during the cycle were updated. Coverage.Roots and
+	// Coverage.Ignored are then those of the latest full rebuild.
+	Incremental bool
+	// Duration is how long the rebuild took.
+	Duration time.Duration
+	// Previous is the number of directories the previous watch set watched.
+	// Compare it to Dirs to spot a tree that keeps growing, e.g. because a
+	// build writes temporary directories into it.
+	Previous int
+	// Coverage describes the new watch set.
+	Coverage
+	// Err is not nil if the rebuild failed, in which case the previous watch
+	// set is still active.
+	Err error
+}
+
+// Restart describes an attempt to replace a failed event source, with
+// Config.Restarts.
+type Restart struct {
+	// Cycle is the ID of the latest cycle.
+	Cycle uint64
+	// Attempt counts the attempts since the source failed, starting at 1.
+	Attempt int
+	// Delay is how long was waited before the attempt.
+	Delay time.Duration
+	// Err is not nil if the attempt failed.
+	Err error
+}
+
+// Coverage describes which directories a watch set covers.
+type Coverage struct {
+	// Dirs is the number of directories watched.
+	Dirs int
+	// Roots describes the watch set of each of Config.Dirs, in order,
+	// followed by the matches of Config.Globs.
+	Roots []RootCoverage
+	// Ignored are the directories left out because of Config.Ignore, with
+	// the pattern that matched. Their subdirectories are not walked.
+	Ignored []Ignored
+	// Uncovered are the directories left out because of Config.MaxDirs.
+	// Their subdirectories are not watched either, unless they are polled
+	// with Config.PollUncovered.
+	Uncovered []string
+	// Failed are the directories that could not be walked or watched, with
+	// Config.AllowPartial. Their subdirectories are not watched either.
+	Failed []*fs.PathError
+}
+
+// RootCoverage describes the watch set of one of Config.Dirs, or of a match
+// of Config.Globs.
+type RootCoverage struct {
+	// Path is the root, as in Config.Dirs, or the match.
+	Path string
+	// Dirs is the number of directories watched for this root. Directories
+	// that are also under an earlier root are counted there.
+	Dirs int
+	// Backend is how changes are found: "fsnotify", "poll", or "custom" with
+	// Config.NewSource.
+	Backend string
+}
+
+// Ignored is a directory excluded from a watch set by Config.Ignore, or a
+// mount point excluded by Config.SameFilesystem.
+type Ignored struct {
+	Path string
+	// Pattern is the Ignore pattern that matched, or "" for a mount point.
+	Pattern string
+}
+
+// Error is an error the watcher recovered from, as passed to Config.OnError.
+type Error struct {
+	// Kind classifies the error.
+	Kind ErrorKind
+	// Cycle is the ID of the cycle during which the error happened, or 0 if
+	// it happened before the first cycle.
+	Cycle uint64
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string { return e.Kind.String() + ": " + e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorKind is the kind of an Error.
+type ErrorKind int
+
+const (
+	// SourceError is an error reported by the event source, or by closing
+	// it.
+	SourceError ErrorKind = iota + 1
+	// OverflowError is reported when the event source dropped events, e.g.
+	// because the system's event queue was full. Changes may have been
+	// missed.
+	OverflowError
+	// RescanError is reported when rebuilding the watch set after a cycle
+	// fails. The previous watch set is still active.
+	RescanError
+	// StateError is reported when reading or saving Manifest, Tree or
+	// Journal fails.
+	StateError
+	// TimeoutError is reported when OnChange runs longer than
+	// Config.Timeout.
+	TimeoutError
+	// PanicError is reported when OnChange panics, with Config.OnPanic.
+	PanicError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case SourceError:
+		return "source"
+	case OverflowError:
+		return "overflow"
+	case RescanError:
+		return "rescan"
+	case StateError:
+		return "state"
+	case TimeoutError:
+		return "timeout"
+	case PanicError:
+		return "panic"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// DefaultDebounce is the Debounce set by DefaultConfig.
+const DefaultDebounce = 100 * time.Millisecond
+
+// DefaultRescanBackoff is the delay before the first retry of
+// Config.RescanRetries if Config.RescanBackoff is not set.
+const DefaultRescanBackoff = 100 * time.Millisecond
+
+// DefaultRestartBackoff is the delay before the first attempt of
+// Config.Restarts if Config.RestartBackoff is not set.
+const DefaultRestartBackoff = 100 * time.Millisecond
+
+// maxRescanBackoff is the longest delay between retries of
+// Config.RescanRetries and attempts of Config.Restarts.
+const maxRescanBackoff = time.Minute
+
+// DefaultIgnore is the Ignore list set by DefaultConfig: version control
+// metadata and dependency directories that are rarely worth watching.
+var DefaultIgnore = []string{".git", ".hg", ".svn", "node_modules"}
+
+// DefaultConfig returns a Config with the default debounce, ignore list and
+// logger. Dirs and OnChange must still be set.
+func DefaultConfig() Config {
+	return Config{
+		Debounce: DefaultDebounce,
+		Ignore:   append([]string(nil), DefaultIgnore...),
+		Logger:   slog.Default(),
+	}
+}
+
+// Validate reports the first problem that would prevent c from being watched.
+func (c Config) Validate() error {
+	if len(c.Dirs) == 0 && len(c.Globs) == 0 {
+		return fmt.Errorf("empty Dirs and Globs")
+	}
+	for _, pattern := range c.Globs {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid Globs pattern %q: %w", pattern, err)
+		}
+		if dir := filepath.Dir(filepath.Clean(pattern)); hasMeta(dir) {
+			return fmt.Errorf("wildcards before the last element of Globs pattern %q", pattern)
+		}
+	}
+	if len(c.Globs) > 0 && c.Tree != nil {
+		return fmt.Errorf("Tree can't be used with Globs")
+	}
+	if c.Debounce < 0 {
+		return fmt.Errorf("negative Debounce: %v", c.Debounce)
+	}
+	if c.FilterWorkers < 0 {
+		return fmt.Errorf("negative FilterWorkers: %d", c.FilterWorkers)
+	}
+	if c.MaxDirs < 0 {
+		return fmt.Errorf("negative MaxDirs: %d", c.MaxDirs)
+	}
+	if c.Poll < 0 {
+		return fmt.Errorf("negative Poll: %v", c.Poll)
+	}
+	for _, dir := range c.PollDirs {
+		if !slices.Contains(c.Dirs, dir) {
+			return fmt.Errorf("PollDirs has %q, which is not in Dirs", dir)
+		}
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("negative Timeout: %v", c.Timeout)
+	}
+	if c.RescanRetries < 0 {
+		return fmt.Errorf("negative RescanRetries: %d", c.RescanRetries)
+	}
+	if c.RescanBackoff < 0 {
+		return fmt.Errorf("negative RescanBackoff: %v", c.RescanBackoff)
+	}
+	if c.Restarts < 0 {
+		return fmt.Errorf("negative Restarts: %d", c.Restarts)
+	}
+	if c.RestartBackoff < 0 {
+		return fmt.Errorf("negative RestartBackoff: %v", c.RestartBackoff)
+	}
+	if c.Reconcile < 0 {
+		return fmt.Errorf("negative Reconcile: %v", c.Reconcile)
+	}
+	if c.FS != nil {
+		for _, dir := range append(c.Dirs[:len(c.Dirs):len(c.Dirs)], c.Globs...) {
+			if !fs.ValidPath(dir) {
+				return fmt.Errorf("invalid path in FS: %q", dir)
+			}
+		}
+		if c.Manifest != "" || c.DiffSize > 0 || c.Tree != nil || c.FollowSymlinks {
+			return fmt.Errorf("Manifest, DiffSize, Tree and FollowSymlinks can't be used with FS")
+		}
+	}
+	for _, pattern := range c.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid Ignore pattern %q: %w", pattern, err)
+		}
+	}
+	if c.Filter != nil {
+		if err := validateFilter(c.Filter); err != nil {
+			return err
+		}
+	}
+	if c.OnChange == nil {
+		return fmt.Errorf("nil OnChange")
+	}
+	for i, h := range c.Handlers {
+		if err := c.handler(h).Validate(); err != nil {
+			return fmt.Errorf("handler %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// handler returns the Config of the loop that runs h. It shares the watch
+// settings of c, but not its hooks, persistence, Tree or Latency.
+func (c Config) handler(h Handler) Config {
+	c.Debounce = h.Debounce
+	c.Ignore = append(c.Ignore[:len(c.Ignore):len(c.Ignore)], h.Ignore...)
+	if c.Filter != nil && h.Filter != nil {
+		c.Filter = And(c.Filter, h.Filter)
+	} else if h.Filter != nil {
+		c.Filter = h.Filter
+	}
+	c.Initial = h.Initial
+	c.OnChange = h.OnChange
+	c.Handlers = nil
+	c.Manifest = ""
+	c.DiffSize = 0
+	c.Tree = nil
+	c.Latency = nil
+	c.Journal = ""
+	c.OnReady = nil
+	c.OnRescan = nil
+	c.OnRestart = nil
+	return c
+}
+
+// hasMeta reports whether path has any of the wildcards of filepath.Match.
+func hasMeta(path string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.ContainsAny(path, `*?[`)
+	}
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+// ignoredBy returns the first Ignore pattern that matches the base name of
+// path, or "" if none does.
+func (c Config) ignoredBy(path string) string {
+	base := filepath.Base(path)
+	if c.ignore != nil {
+		return c.ignore.match(base)
+	}
+	for _, pattern := range c.Ignore {
+		if ok, _ := filepath.Match(normPath(pattern), base); ok {
+			return pattern
+		}
+	}
+	return ""
+}
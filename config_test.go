@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	onchange := func(context.Context, Cycle) bool { return true }
+
+	c := DefaultConfig()
+	if err := c.Validate(); err == nil {
+		t.Errorf("default config without Dirs should not be valid")
+	}
+
+	c.Dirs = []string{"."}
+	c.OnChange = onchange
+	if err := c.Validate(); err != nil {
+		t.Errorf("default config with Dirs and OnChange should be valid: %v", err)
+	}
+
+	bad := map[string]func(*Config){
+		"nil OnChange":      func(c *Config) { c.OnChange = nil },
+		"negative Debounce": func(c *Config) { c.Debounce = -1 },
+		"negative MaxDirs":  func(c *Config) { c.MaxDirs = -1 },
+		"unknown PollDirs":  func(c *Config) { c.PollDirs = []string{"elsewhere"} },
+		"bad pattern":       func(c *Config) { c.Ignore = append(c.Ignore, "[") },
+		"bad glob":          func(c *Config) { c.Globs = []string{"a/["} },
+		"glob dir wildcard": func(c *Config) { c.Globs = []string{"*/x"} },
+		"nil handler":       func(c *Config) { c.Handlers = []Handler{{}} },
+		"bad handler":       func(c *Config) { c.Handlers = []Handler{{OnChange: onchange, Ignore: []string{"["}}} },
+	}
+	for name, modify := range bad {
+		c := DefaultConfig()
+		c.Dirs = []string{"."}
+		c.OnChange = onchange
+		modify(&c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestConfigIgnored(t *testing.T) {
+	c := DefaultConfig()
+	c.Ignore = append(c.Ignore, "*.tmp")
+	for path, want := range map[string]bool{
+		"src/.git":          true,
+		"node_modules":      true,
+		"build/out.tmp":     true,
+		"src/main.go":       false,
+		"src/.gitignore":    false,
+		"node_modules/a.js": false, // only the base name is matched
+	} {
+		if got := c.ignoredBy(path) != ""; got != want {
+			t.Errorf("ignoredBy(%q) matched = %v, want %v", path, got, want)
+		}
+	}
+}
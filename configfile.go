@@ -0,0 +1,88 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+// ConfigFile lets configuration libraries use a watcher to reload a file.
+// It has the methods of a koanf.Provider and of the watching koanf file
+// provider, so that it can replace it:
+//
+//	f := watch.NewConfigFile("config.yaml")
+//	k.Load(f, yaml.Parser())
+//	f.Watch(func(_ any, err error) { ... k.Load(f, yaml.Parser()) ... })
+//
+// With viper, call ReadInConfig from the callback of Watch instead of using
+// WatchConfig and OnConfigChange. Like WatchValue, it watches the file as a
+// root of its own and only calls back when its content changed.
+type ConfigFile struct {
+	path string
+
+	mu   sync.Mutex
+	halt func()
+}
+
+// NewConfigFile returns a ConfigFile for the file at path.
+func NewConfigFile(path string) *ConfigFile {
+	return &ConfigFile{path: path}
+}
+
+// ReadBytes returns the content of the file.
+func (f *ConfigFile) ReadBytes() ([]byte, error) {
+	return os.ReadFile(f.path)
+}
+
+// Read is not supported, as the file has to be parsed; use ReadBytes.
+func (f *ConfigFile) Read() (map[string]interface{}, error) {
+	return nil, errors.New("watch.ConfigFile does not support Read, use ReadBytes")
+}
+
+// Watch calls cb with a nil event and error every time the content of the
+// file changed, or with the error if it can no longer be read, until
+// Unwatch is called. It fails if f is already being watched.
+func (f *ConfigFile) Watch(cb func(event interface{}, err error)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.halt != nil {
+		return errors.New("watch.ConfigFile is already being watched")
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	c := DefaultConfig()
+	c.Dirs = []string{f.path}
+	c.OnChange = func(context.Context, Cycle) bool {
+		next, err := os.ReadFile(f.path)
+		if err != nil {
+			cb(nil, err)
+			return true
+		}
+		if !bytes.Equal(next, data) {
+			data = next
+			cb(nil, nil)
+		}
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		return err
+	}
+	f.halt = w.Halt
+	return nil
+}
+
+// Unwatch stops the watcher started by Watch.
+func (f *ConfigFile) Unwatch() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.halt != nil {
+		f.halt()
+		f.halt = nil
+	}
+	return nil
+}
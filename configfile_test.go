@@ -0,0 +1,49 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("a: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewConfigFile(path)
+	changes := make(chan error, 10)
+	if err := f.Watch(func(_ interface{}, err error) { changes <- err }); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Unwatch()
+	if err := f.Watch(func(interface{}, error) {}); err == nil {
+		t.Errorf("expected an error for a second Watch")
+	}
+
+	if err := os.WriteFile(path, []byte("a: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-changes:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the change was not seen")
+	}
+	if data, err := f.ReadBytes(); err != nil || string(data) != "a: 2\n" {
+		t.Errorf("expected the new content, got %q, %v", data, err)
+	}
+
+	// Other files of the directory don't call back.
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "other"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-changes:
+		t.Errorf("unexpected callback with %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
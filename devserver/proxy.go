@@ -0,0 +1,218 @@
+package devserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/infogulch/watch"
+)
+
+// DefaultProxyWait is how long a Proxy holds a request for a backend that
+// is not ready if Proxy.Wait is not set.
+const DefaultProxyWait = 30 * time.Second
+
+// proxyPoll is how often a Proxy checks if its backend is ready.
+const proxyPoll = 50 * time.Millisecond
+
+// Proxy is a reverse proxy to a development server that is restarted on
+// changes. Requests that arrive while it restarts are held until it is ready
+// again, instead of failing with "connection refused", and requests without
+// a body that fail to connect are retried once it is. Close stops it from
+// checking the backend.
+type Proxy struct {
+	// Health, if not empty, is the path of the backend that answers with a
+	// status below 500 once it is ready. Otherwise it is ready once it
+	// accepts connections.
+	Health string
+
+	// Wait is how long to hold a request for the backend to be ready, after
+	// which it fails with 503 Service Unavailable. If zero, DefaultProxyWait
+	// is used.
+	Wait time.Duration
+
+	// Logger receives the failures of Restart. If nil, slog.Default() is
+	// used.
+	Logger *slog.Logger
+
+	target *url.URL
+	proxy  *httputil.ReverseProxy
+	ctx    context.Context // done once closed
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	ready   chan struct{} // closed while the backend is ready
+	polling bool
+}
+
+// NewProxy returns a Proxy to the backend at target.
+func NewProxy(target *url.URL) *Proxy {
+	p := &Proxy{target: target, ready: make(chan struct{})}
+	close(p.ready)
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.proxy = httputil.NewSingleHostReverseProxy(target)
+	p.proxy.Transport = holdTransport{p, http.DefaultTransport}
+	p.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, errBackendNotReady) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// Close stops checking whether the backend is ready. Requests held until it
+// is fail with 503 Service Unavailable, and so do later ones that find it
+// not ready.
+func (p *Proxy) Close() error {
+	p.cancel()
+	return nil
+}
+
+// Restart returns an OnChange that holds new requests while restart runs,
+// until the backend it starts is ready. The watcher keeps running if restart
+// fails.
+func (p *Proxy) Restart(restart func(ctx context.Context, cycle watch.Cycle) error) func(ctx context.Context, cycle watch.Cycle) bool {
+	return func(ctx context.Context, cycle watch.Cycle) bool {
+		p.hold()
+		if err := restart(ctx, cycle); err != nil {
+			log := p.Logger
+			if log == nil {
+				log = slog.Default()
+			}
+			log.Error("failed to restart backend", "cycle", cycle.ID, "error", err)
+		}
+		p.poll()
+		return true
+	}
+}
+
+// hold makes requests wait until poll finds the backend ready.
+func (p *Proxy) hold() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready:
+		p.ready = make(chan struct{})
+	default:
+	}
+}
+
+// poll checks the backend until it is ready, and then lets the held requests
+// through, or until p is closed.
+func (p *Proxy) poll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.polling {
+		return
+	}
+	p.polling = true
+	ready := p.ready
+	go func() {
+		ticker := time.NewTicker(proxyPoll)
+		defer ticker.Stop()
+		for !p.healthy() {
+			select {
+			case <-ticker.C:
+			case <-p.ctx.Done():
+			}
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.polling = false
+		if p.ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ready:
+		default:
+			close(ready)
+		}
+	}()
+}
+
+// healthy reports whether the backend is ready. It returns true once p is
+// closed, so that poll stops.
+func (p *Proxy) healthy() bool {
+	if p.ctx.Err() != nil {
+		return true
+	}
+	if p.Health == "" {
+		dialer := net.Dialer{Timeout: proxyPoll}
+		conn, err := dialer.DialContext(p.ctx, "tcp", p.target.Host)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.target.JoinPath(p.Health).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 500
+}
+
+// wait blocks until the backend is ready, or until deadline or p is closed.
+func (p *Proxy) wait(ctx context.Context, deadline time.Time) error {
+	p.mu.Lock()
+	ready := p.ready
+	p.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-time.After(time.Until(deadline)):
+		return errBackendNotReady
+	case <-p.ctx.Done():
+		return errBackendNotReady
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var errBackendNotReady = errors.New("backend is not ready")
+
+// holdTransport holds requests until the backend of p is ready, and retries
+// the ones without a body that fail to connect.
+type holdTransport struct {
+	p    *Proxy
+	base http.RoundTripper
+}
+
+func (t holdTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	wait := t.p.Wait
+	if wait == 0 {
+		wait = DefaultProxyWait
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		if err := t.p.wait(r.Context(), deadline); err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(r)
+		var op *net.OpError
+		if err == nil || !errors.As(err, &op) || op.Op != "dial" || (r.Body != nil && r.Body != http.NoBody) {
+			return resp, err
+		}
+		t.p.hold()
+		t.p.poll()
+	}
+}
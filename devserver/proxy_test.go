@@ -0,0 +1,108 @@
+package devserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/infogulch/watch"
+)
+
+func TestProxy(t *testing.T) {
+	serve := func(ln net.Listener, body string) *http.Server {
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		})}
+		go srv.Serve(ln)
+		return srv
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	backend := serve(ln, "v1")
+	defer func() { backend.Close() }()
+
+	p := NewProxy(&url.URL{Scheme: "http", Host: addr})
+	front := httptest.NewServer(p)
+	defer front.Close()
+	get := func() string {
+		t.Helper()
+		resp, err := http.Get(front.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if body := get(); body != "v1" {
+		t.Errorf("expected v1, got %q", body)
+	}
+
+	restarting := make(chan struct{})
+	onchange := p.Restart(func(context.Context, watch.Cycle) error {
+		backend.Close()
+		close(restarting)
+		time.Sleep(100 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		backend = serve(ln, "v2")
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		onchange(context.Background(), watch.Cycle{ID: 1})
+		close(done)
+	}()
+	<-restarting
+	if body := get(); body != "v2" {
+		t.Errorf("expected the request to be held until v2 was up, got %q", body)
+	}
+	<-done
+}
+
+func TestProxyClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // the backend never comes up
+
+	p := NewProxy(&url.URL{Scheme: "http", Host: addr})
+	p.Wait = time.Minute
+	front := httptest.NewServer(p)
+	defer front.Close()
+	p.Restart(func(context.Context, watch.Cycle) error { return nil })(context.Background(), watch.Cycle{ID: 1})
+
+	time.AfterFunc(100*time.Millisecond, func() { p.Close() })
+	start := time.Now()
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || time.Since(start) > 10*time.Second {
+		t.Errorf("expected 503 once closed, got %d after %v", resp.StatusCode, time.Since(start))
+	}
+	for i := 0; ; i++ {
+		p.mu.Lock()
+		polling := p.polling
+		p.mu.Unlock()
+		if !polling {
+			break
+		} else if i == 100 {
+			t.Fatal("expected polling to stop once closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
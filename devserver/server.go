@@ -0,0 +1,198 @@
+// Package devserver serves sites and proxies servers under development,
+// rebuilding or restarting them on the cycles of a watcher. It is a package of
+// its own so that the watch package doesn't import net/http.
+package devserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infogulch/watch"
+)
+
+// ReloadPath is the path a Server sends reload events on to the browsers
+// viewing its pages.
+const ReloadPath = "/.watch/reload"
+
+const reloadScript = `<script>new EventSource("` + ReloadPath + `").onmessage = () => location.reload()</script>`
+
+// Server serves the output of a static site generator while it is being
+// edited: Build is run for every cycle of the watcher, and the browsers
+// viewing pages of Dir reload once it succeeds. Use its OnChange as that of
+// the watch.Config watching the sources, and serve it over HTTP, or have Run do
+// both.
+type Server struct {
+	// Dir is the directory served, where Build writes the site.
+	Dir string
+
+	// Build, if not nil, builds the site into Dir for the changes of cycle.
+	// Browsers are not reloaded if it fails.
+	Build func(ctx context.Context, cycle watch.Cycle) error
+
+	// Logger receives build failures. If nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+// OnChange runs Build for cycle and reloads the browsers if it succeeded. It
+// always keeps the watcher running.
+func (s *Server) OnChange(ctx context.Context, cycle watch.Cycle) bool {
+	if s.Build != nil {
+		if err := s.Build(ctx, cycle); err != nil {
+			log := s.Logger
+			if log == nil {
+				log = slog.Default()
+			}
+			log.Error("failed to build site", "cycle", cycle.ID, "error", err)
+			return true
+		}
+	}
+	s.Reload()
+	return true
+}
+
+// Reload tells every browser viewing a page to reload it.
+func (s *Server) Reload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		select {
+		case client <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+}
+
+// ServeHTTP serves the files of Dir, with index.html for directories, and
+// the reload events on ReloadPath. HTML pages get a script that reloads them
+// on those events.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == ReloadPath {
+		s.events(w, r)
+		return
+	}
+	// Pages are opened through http.Dir, like the other files, so that the
+	// request can't reach out of Dir.
+	dir := http.Dir(s.Dir)
+	name := path.Clean("/" + r.URL.Path)
+	if info, err := stat(dir, name); err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+	}
+	if !reloadPage(name) {
+		http.FileServer(dir).ServeHTTP(w, r)
+		return
+	}
+	page, err := readFile(dir, name)
+	if err != nil {
+		http.FileServer(dir).ServeHTTP(w, r)
+		return
+	}
+	if i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>")); i >= 0 {
+		page = append(page[:i:i], append([]byte(reloadScript), page[i:]...)...)
+	} else {
+		page = append(page, reloadScript...)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(page))
+}
+
+// events sends a server-sent event to the browser of r on every Reload, until
+// it goes away.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	client := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.clients == nil {
+		s.clients = map[chan struct{}]struct{}{}
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-client:
+			if _, err := fmt.Fprint(w, "data: reload\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Run serves s on addr while c watches the sources of the site, until ctx is
+// done or the watcher stops, and returns why as watch.Config.Run does.
+// c.OnChange is replaced by that of s, and c.Initial is set so that the site
+// is built when it starts.
+func (s *Server) Run(ctx context.Context, c watch.Config, addr string) error {
+	c.OnChange = s.OnChange
+	c.Initial = true
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: s}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	err = c.Run(ctx)
+	srv.Close() // reload event streams never end on their own
+	if serr := <-served; !errors.Is(serr, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve %s: %w", addr, serr)
+	}
+	return err
+}
+
+// stat returns the FileInfo of name in dir.
+func stat(dir http.Dir, name string) (fs.FileInfo, error) {
+	f, err := dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// readFile returns the content of name in dir.
+func readFile(dir http.Dir, name string) ([]byte, error) {
+	f, err := dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// reloadPage reports whether name is served with the reload script.
+func reloadPage(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".html" || ext == ".htm"
+}
@@ -0,0 +1,97 @@
+package devserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/infogulch/watch"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><body>hi</body></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte("body {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fail := false
+	s := &Server{Dir: dir, Build: func(context.Context, watch.Cycle) error {
+		if fail {
+			return errors.New("broken")
+		}
+		return nil
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func(path string) string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if page := get("/"); page != "<html><body>hi"+reloadScript+"</body></html>" {
+		t.Errorf("expected the page with the reload script, got %q", page)
+	}
+	if css := get("/style.css"); css != "body {}" {
+		t.Errorf("expected the stylesheet as is, got %q", css)
+	}
+
+	resp, err := http.Get(srv.URL + ReloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+
+	fail = true
+	s.OnChange(context.Background(), watch.Cycle{ID: 1})
+	s.mu.Lock()
+	for client := range s.clients {
+		if len(client) > 0 {
+			t.Errorf("a failed build reloaded the browsers")
+		}
+	}
+	s.mu.Unlock()
+
+	fail = false
+	s.OnChange(context.Background(), watch.Cycle{ID: 2})
+	line, err := events.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "data: reload" {
+		t.Errorf("expected a reload event, got %q, %v", line, err)
+	}
+}
+
+func TestServerOutsideDir(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "site")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret.html"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Dir: dir}
+	for _, path := range []string{"/../secret.html", `/..\secret.html`} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = path
+		s.ServeHTTP(w, r)
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("%s served a page outside of Dir", path)
+		}
+	}
+}
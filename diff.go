@@ -0,0 +1,234 @@
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// errNotText is returned by readText for files that are too large or binary.
+var errNotText = errors.New("not a small text file")
+
+// readText returns the content of the file at path if it is valid UTF-8
+// without NUL bytes and no larger than max bytes.
+func readText(path string, max int64) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() || info.Size() > max {
+		return "", errNotText
+	}
+	f, err := openRegular(path)
+	if errors.Is(err, errNotRegular) {
+		return "", errNotText
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > max || !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", errNotText
+	}
+	return string(data), nil
+}
+
+// texts caches the content of small text files so their changes can be
+// diffed.
+type texts struct {
+	max   int64
+	files map[string]string
+}
+
+// loadTexts reads every small text file under c.Dirs.
+func (c Config) loadTexts() (*texts, error) {
+	t := &texts{max: c.DiffSize, files: map[string]string{}}
+	err := c.walkFiles(func(path string, d fs.DirEntry) error {
+		if content, err := readText(path, t.max); err == nil {
+			t.files[path] = content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text files: %w", err)
+	}
+	return t, nil
+}
+
+// update re-reads each path and returns a unified diff for every one whose
+// content changed, keyed by path. Created and removed files are diffed
+// against empty content. Files that are not (or are no longer) small text
+// files are dropped from the cache and not diffed.
+func (t *texts) update(paths []string) map[string]string {
+	diffs := map[string]string{}
+	for _, path := range paths {
+		old, had := t.files[path]
+		cur, err := readText(path, t.max)
+		switch {
+		case err == nil:
+			t.files[path] = cur
+		case errors.Is(err, fs.ErrNotExist):
+			delete(t.files, path)
+			if !had {
+				continue
+			}
+		default:
+			delete(t.files, path)
+			continue
+		}
+		if had && old == cur {
+			continue
+		}
+		diffs[path] = unifiedDiff(path, old, cur)
+	}
+	return diffs
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diffMaxCells bounds the size of the table used to diff the lines between
+// the common prefix and suffix. Larger changes are shown as a full rewrite.
+const diffMaxCells = 1 << 22
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the changes from a to b in unified diff format, or ""
+// if they are equal.
+func unifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	aLine, bLine := 0, 0 // lines of a and b before lines[i]
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			aLine, bLine = aLine+1, bLine+1
+			i++
+			continue
+		}
+		// lines[i] is the first change of a hunk; back up to include context.
+		start := max(0, i-diffContext)
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		// extend the hunk until the next change is too far away.
+		end, unchanged := i, 0
+		for j := i; j < len(lines) && unchanged <= 2*diffContext; j++ {
+			if lines[j].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+				end = j + 1
+			}
+		}
+		end = min(len(lines), end+diffContext)
+
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, l := range lines[start:end] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		aLine, bLine = aStart+aCount, bStart+bCount
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits s after each newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns a minimal edit script from a to b, using the longest
+// common subsequence of the lines between their common prefix and suffix.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	if (n+1)*(m+1) > diffMaxCells {
+		for _, l := range ma {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range mb {
+			lines = append(lines, diffLine{'+', l})
+		}
+	} else {
+		// lcs[i*(m+1)+j] is the length of the LCS of ma[i:] and mb[j:].
+		lcs := make([]int32, (n+1)*(m+1))
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+				} else {
+					lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && ma[i] == mb[j]:
+				lines = append(lines, diffLine{' ', ma[i]})
+				i, j = i+1, j+1
+			case j == m || (i < n && lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]):
+				lines = append(lines, diffLine{'-', ma[i]})
+				i++
+			default:
+				lines = append(lines, diffLine{'+', mb[j]})
+				j++
+			}
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
@@ -0,0 +1,93 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(ls ...string) string { return strings.Join(ls, "\n") + "\n" }
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\n", "a\n", ""},
+		{"create", "", "a\nb\n", lines(
+			"--- f", "+++ f",
+			"@@ -0,0 +1,2 @@",
+			"+a", "+b",
+		)},
+		{"remove", "a\n", "", lines(
+			"--- f", "+++ f",
+			"@@ -1,1 +0,0 @@",
+			"-a",
+		)},
+		{"context", lines("1", "2", "3", "4", "5", "6", "7", "8", "9"), lines("1", "2", "3", "4", "five", "6", "7", "8", "9"), lines(
+			"--- f", "+++ f",
+			"@@ -2,7 +2,7 @@",
+			" 2", " 3", " 4", "-5", "+five", " 6", " 7", " 8",
+		)},
+		{"two hunks", lines("a", "1", "2", "3", "4", "5", "6", "7", "8", "b"), lines("A", "1", "2", "3", "4", "5", "6", "7", "8", "B"), lines(
+			"--- f", "+++ f",
+			"@@ -1,4 +1,4 @@",
+			"-a", "+A", " 1", " 2", " 3",
+			"@@ -7,4 +7,4 @@",
+			" 6", " 7", " 8", "-b", "+B",
+		)},
+		{"no newline", "a", "b", lines(
+			"--- f", "+++ f",
+			"@@ -1,1 +1,1 @@",
+			"-a", `\ No newline at end of file`,
+			"+b", `\ No newline at end of file`,
+		)},
+	} {
+		if got := unifiedDiff("f", tc.a, tc.b); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTextsUpdate(t *testing.T) {
+	dir := t.TempDir()
+	text := filepath.Join(dir, "a.txt")
+	binary := filepath.Join(dir, "b.bin")
+	if err := os.WriteFile(text, []byte("a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, []byte{0, 1, 2}, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.DiffSize = 1024
+	cache, err := c.loadTexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(text, []byte("b\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, []byte{0, 4, 5}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	diffs := cache.update([]string{text, binary})
+	if len(diffs) != 1 || !strings.Contains(diffs[text], "-a\n+b\n") {
+		t.Errorf("unexpected diffs: %q", diffs)
+	}
+
+	if err := os.Remove(text); err != nil {
+		t.Fatal(err)
+	}
+	diffs = cache.update([]string{text})
+	if !strings.Contains(diffs[text], "-b\n") {
+		t.Errorf("expected removal diff, got %q", diffs)
+	}
+	if diffs = cache.update([]string{text}); len(diffs) != 0 {
+		t.Errorf("expected no diff for a file that is still removed, got %q", diffs)
+	}
+}
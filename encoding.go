@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ops names the fsnotify operations in the JSON form of events.
+var ops = []struct {
+	op   fsnotify.Op
+	name string
+}{
+	{fsnotify.Create, "create"},
+	{fsnotify.Write, "write"},
+	{fsnotify.Remove, "remove"},
+	{fsnotify.Rename, "rename"},
+	{fsnotify.Chmod, "chmod"},
+}
+
+// eventJSON is the JSON form of an fsnotify.Event.
+type eventJSON struct {
+	Path string   `json:"path"`
+	Ops  []string `json:"ops"`
+}
+
+// MarshalEvent encodes ev as a JSON object with its path and the names of
+// its operations, e.g. {"path":"a.go","ops":["create","write"]}, for tools
+// that don't know the bits of fsnotify.Op.
+func MarshalEvent(ev fsnotify.Event) ([]byte, error) {
+	e := eventJSON{Path: ev.Name, Ops: []string{}}
+	for _, o := range ops {
+		if ev.Op.Has(o.op) {
+			e.Ops = append(e.Ops, o.name)
+		}
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalEvent decodes an event encoded by MarshalEvent.
+func UnmarshalEvent(data []byte) (fsnotify.Event, error) {
+	var e eventJSON
+	if err := json.Unmarshal(data, &e); err != nil {
+		return fsnotify.Event{}, fmt.Errorf("failed to decode event: %w", err)
+	}
+	ev := fsnotify.Event{Name: e.Path}
+next:
+	for _, name := range e.Ops {
+		for _, o := range ops {
+			if o.name == name {
+				ev.Op |= o.op
+				continue next
+			}
+		}
+		return fsnotify.Event{}, fmt.Errorf("failed to decode event: unknown op %q", name)
+	}
+	return ev, nil
+}
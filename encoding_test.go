@@ -0,0 +1,78 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestEventJSON(t *testing.T) {
+	ev := fsnotify.Event{Name: "src/a.go", Op: fsnotify.Create | fsnotify.Write}
+	data, err := MarshalEvent(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"path":"src/a.go","ops":["create","write"]}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	got, err := UnmarshalEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ev {
+		t.Errorf("got %v, want %v", got, ev)
+	}
+	if _, err := UnmarshalEvent([]byte(`{"path":"a","ops":["delete"]}`)); err == nil {
+		t.Error("unknown op decoded")
+	}
+}
+
+func TestCycleEncoding(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cycle := Cycle{
+		ID:    3,
+		Start: now,
+		Time:  now.Add(time.Second),
+		Paths: []string{"a.go", "b.go", "c.go"},
+		Changes: ChangeSet{
+			Created: []string{"c.go"},
+			Renamed: []Rename{{From: "a.go", To: "b.go"}},
+		},
+		Stats: map[string]Stat{"c.go": {Exists: true, Size: 4, ModTime: now, Mode: 0o644}},
+	}
+
+	data, err := json.Marshal(cycle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"cycle":3,"start":"2024-01-02T03:04:05Z","time":"2024-01-02T03:04:06Z",` +
+		`"paths":["a.go","b.go","c.go"],"changes":{"created":["c.go"],"renamed":[{"from":"a.go","to":"b.go"}]},` +
+		`"stats":{"c.go":{"exists":true,"size":4,"mtime":"2024-01-02T03:04:05Z","mode":420}}}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+	var fromJSON Cycle
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, cycle) {
+		t.Errorf("JSON round trip: got %+v, want %+v", fromJSON, cycle)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cycle); err != nil {
+		t.Fatal(err)
+	}
+	var fromGob Cycle
+	if err := gob.NewDecoder(&buf).Decode(&fromGob); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromGob, cycle) {
+		t.Errorf("gob round trip: got %+v, want %+v", fromGob, cycle)
+	}
+}
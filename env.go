@@ -0,0 +1,47 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Environment variables that override the corresponding Config fields when
+// applied with FromEnv. They are meant for deployments where the watch
+// configuration has to change without touching the command line or the code
+// that embeds this package. Nothing else in this package reads them, neither
+// Watch nor the helpers like WatchValue.
+//
+// Precedence, highest first: environment variable, Config field,
+// DefaultConfig. An unset or empty variable leaves the field as is.
+const (
+	// EnvDirs is a list of directories to watch, separated by the OS path list
+	// separator (':' on unix, ';' on windows). Replaces Config.Dirs.
+	EnvDirs = "WATCH_DIRS"
+	// EnvDebounce is a duration in time.ParseDuration format, e.g. "250ms".
+	// Replaces Config.Debounce.
+	EnvDebounce = "WATCH_DEBOUNCE"
+	// EnvIgnore is a list of ignore patterns, separated like EnvDirs. Replaces
+	// Config.Ignore.
+	EnvIgnore = "WATCH_IGNORE"
+)
+
+// FromEnv returns c with the fields overridden by EnvDirs, EnvDebounce and
+// EnvIgnore replaced, e.g. for the Config of the main watcher of a program.
+func FromEnv(c Config) (Config, error) {
+	if v := os.Getenv(EnvDirs); v != "" {
+		c.Dirs = filepath.SplitList(v)
+	}
+	if v := os.Getenv(EnvDebounce); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s: %w", EnvDebounce, err)
+		}
+		c.Debounce = d
+	}
+	if v := os.Getenv(EnvIgnore); v != "" {
+		c.Ignore = filepath.SplitList(v)
+	}
+	return c, nil
+}
@@ -0,0 +1,57 @@
+package watch
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromEnv(t *testing.T) {
+	c := Config{Dirs: []string{"a"}, Debounce: time.Second, Ignore: []string{"x"}}
+	got, err := FromEnv(c)
+	if err != nil {
+		t.Fatalf("unset env: %v", err)
+	}
+	if !slices.Equal(got.Dirs, c.Dirs) || got.Debounce != c.Debounce || !slices.Equal(got.Ignore, c.Ignore) {
+		t.Errorf("unset env changed config: %+v", got)
+	}
+
+	sep := string(filepath.ListSeparator)
+	t.Setenv(EnvDirs, "b"+sep+"c")
+	t.Setenv(EnvDebounce, "250ms")
+	t.Setenv(EnvIgnore, "*.tmp"+sep+"dist")
+	got, err = FromEnv(c)
+	if err != nil {
+		t.Fatalf("set env: %v", err)
+	}
+	if !slices.Equal(got.Dirs, []string{"b", "c"}) || got.Debounce != 250*time.Millisecond || !slices.Equal(got.Ignore, []string{"*.tmp", "dist"}) {
+		t.Errorf("env did not override config: %+v", got)
+	}
+
+	t.Setenv(EnvDebounce, "soon")
+	if _, err = FromEnv(c); err == nil {
+		t.Errorf("expected error for invalid %s", EnvDebounce)
+	}
+}
+
+func TestEnvNotApplied(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvDirs, filepath.Join(dir, "elsewhere"))
+	c := Config{Dirs: []string{dir}}
+	var out strings.Builder
+	if err := c.DryRun(&out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "watch " + dir + "\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	t.Setenv(EnvDebounce, "soon")
+	halt, err := Watch([]string{dir}, 0, nil, func() bool { return true })
+	if err != nil {
+		t.Fatalf("expected Watch to not read %s: %v", EnvDebounce, err)
+	}
+	halt <- struct{}{}
+}
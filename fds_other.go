@@ -0,0 +1,12 @@
+//go:build !unix
+
+package watch
+
+// openNonblock is 0: elsewhere, FIFOs are not in the file system.
+const openNonblock = 0
+
+// isDescriptorLimit reports false: only Unix limits file descriptors this
+// way.
+func isDescriptorLimit(err error) bool { return false }
+
+func descriptorLimit() int { return 0 }
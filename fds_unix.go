@@ -0,0 +1,27 @@
+//go:build unix
+
+package watch
+
+import (
+	"errors"
+	"syscall"
+)
+
+// openNonblock opens a FIFO without waiting for a writer.
+const openNonblock = syscall.O_NONBLOCK
+
+// isDescriptorLimit reports whether err is the process or the system running
+// out of file descriptors.
+func isDescriptorLimit(err error) bool {
+	return err != nil && (errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE))
+}
+
+// descriptorLimit returns the soft limit on file descriptors of the process,
+// or 0 if it is unknown or unlimited.
+func descriptorLimit() int {
+	var r syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &r); err != nil {
+		return 0
+	}
+	return max(int(r.Cur), 0)
+}
@@ -0,0 +1,28 @@
+//go:build !unix
+
+package watch
+
+import (
+	"io/fs"
+	"os"
+)
+
+// reuseListings is whether listings are kept between rescans. It is off,
+// since os.SameFile opens both files to compare them where there are no
+// inodes: checking a listing would cost more than reading the directory.
+const reuseListings = false
+
+// fileID identifies a file for os.SameFile, which needs its fs.FileInfo
+// where there are no inodes.
+type fileID struct{ info fs.FileInfo }
+
+// fileIDOf returns the fileID of info.
+func fileIDOf(info fs.FileInfo) fileID { return fileID{info} }
+
+// sameFile reports whether a and b are known and the same file.
+func sameFile(a, b fileID) bool {
+	return a.info != nil && b.info != nil && os.SameFile(a.info, b.info)
+}
+
+// deviceOf reports false: devices are only known on Unix.
+func deviceOf(d fs.DirEntry) (uint64, bool) { return 0, false }
@@ -0,0 +1,42 @@
+//go:build unix
+
+package watch
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// reuseListings is whether listings are kept between rescans: comparing
+// fileIDs is free, as they are taken from the stat already made.
+const reuseListings = true
+
+// fileID identifies a file by its device and inode, which is all polling
+// keeps of each entry to find moves, rather than its whole fs.FileInfo.
+type fileID struct{ dev, ino uint64 }
+
+// fileIDOf returns the fileID of info, or the zero fileID if info is not of
+// the OS filesystem.
+func fileIDOf(info fs.FileInfo) fileID {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+}
+
+// sameFile reports whether a and b are known and the same file.
+func sameFile(a, b fileID) bool { return a != fileID{} && a == b }
+
+// deviceOf returns the device of the file of d, if known.
+func deviceOf(d fs.DirEntry) (uint64, bool) {
+	info, err := d.Info()
+	if err != nil {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
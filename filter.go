@@ -0,0 +1,167 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filter selects the event paths that OnChange is called for, as set in
+// Config.Filter. Build one from Glob, Ext, Hidden and Size, combined with
+// And, Or and Not. String describes the filter, e.g. for logs; the filters of
+// this package print as the expression that builds them.
+type Filter interface {
+	Match(path string) bool
+	String() string
+}
+
+// validFilter is implemented by the filters of this package that can be
+// malformed, so Config.Validate can report them.
+type validFilter interface {
+	valid() error
+}
+
+func validateFilter(f Filter) error {
+	if v, ok := f.(validFilter); ok {
+		return v.valid()
+	}
+	return nil
+}
+
+type and []Filter
+
+// And matches paths matched by every one of filters. It matches every path if
+// filters is empty.
+func And(filters ...Filter) Filter { return and(filters) }
+
+func (a and) Match(path string) bool {
+	for _, f := range a {
+		if !f.Match(path) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a and) String() string { return join("And", a) }
+func (a and) valid() error   { return validAll(a) }
+
+type or []Filter
+
+// Or matches paths matched by any of filters. It matches no path if filters
+// is empty.
+func Or(filters ...Filter) Filter { return or(filters) }
+
+func (o or) Match(path string) bool {
+	for _, f := range o {
+		if f.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o or) String() string { return join("Or", o) }
+func (o or) valid() error   { return validAll(o) }
+
+type not struct{ f Filter }
+
+// Not matches the paths that f does not.
+func Not(f Filter) Filter { return not{f} }
+
+func (n not) Match(path string) bool { return !n.f.Match(path) }
+func (n not) String() string         { return "Not(" + n.f.String() + ")" }
+func (n not) valid() error           { return validateFilter(n.f) }
+
+type glob string
+
+// Glob matches paths whose base name matches the filepath.Match pattern, as
+// Config.Ignore does.
+func Glob(pattern string) Filter { return glob(normPath(pattern)) }
+
+func (g glob) Match(path string) bool {
+	ok, _ := filepath.Match(string(g), filepath.Base(path))
+	return ok
+}
+
+func (g glob) String() string { return fmt.Sprintf("Glob(%q)", string(g)) }
+
+func (g glob) valid() error {
+	if _, err := filepath.Match(string(g), ""); err != nil {
+		return fmt.Errorf("invalid Glob pattern %q: %w", string(g), err)
+	}
+	return nil
+}
+
+type ext []string
+
+// Ext matches paths with any of the extensions exts, e.g. ".go".
+func Ext(exts ...string) Filter {
+	e := make(ext, len(exts))
+	for i, x := range exts {
+		e[i] = normPath(x)
+	}
+	return e
+}
+
+func (e ext) Match(path string) bool {
+	x := filepath.Ext(path)
+	for _, want := range e {
+		if x == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (e ext) String() string {
+	quoted := make([]string, len(e))
+	for i, x := range e {
+		quoted[i] = fmt.Sprintf("%q", x)
+	}
+	return "Ext(" + strings.Join(quoted, ", ") + ")"
+}
+
+type hidden struct{}
+
+// Hidden matches paths whose base name starts with a dot.
+func Hidden() Filter { return hidden{} }
+
+func (hidden) Match(path string) bool { return strings.HasPrefix(filepath.Base(path), ".") }
+func (hidden) String() string         { return "Hidden()" }
+
+type size struct{ min, max int64 }
+
+// Size matches regular files of at least min and, if max is greater than
+// zero, at most max bytes. The file is stat'ed on the OS filesystem when the
+// event arrives, so paths that no longer exist, e.g. after a remove event,
+// are not matched.
+func Size(min, max int64) Filter { return size{min, max} }
+
+func (s size) Match(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return info.Size() >= s.min && (s.max <= 0 || info.Size() <= s.max)
+}
+
+func (s size) String() string { return fmt.Sprintf("Size(%d, %d)", s.min, s.max) }
+
+func join(name string, filters []Filter) string {
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = f.String()
+	}
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func validAll(filters []Filter) error {
+	for _, f := range filters {
+		if err := validateFilter(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.go")
+	if err := os.WriteFile(big, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := And(Or(Ext(".go", ".mod"), Glob("Makefile")), Not(Hidden()), Not(Glob("*_test.go")))
+	want := `And(Or(Ext(".go", ".mod"), Glob("Makefile")), Not(Hidden()), Not(Glob("*_test.go")))`
+	if f.String() != want {
+		t.Errorf("expected %s, got %s", want, f)
+	}
+	for path, match := range map[string]bool{
+		"a/main.go":      true,
+		"a/go.mod":       true,
+		"a/Makefile":     true,
+		"a/.main.go":     false,
+		"a/main_test.go": false,
+		"a/style.css":    false,
+	} {
+		if f.Match(path) != match {
+			t.Errorf("%s: expected match %v", path, match)
+		}
+	}
+
+	if !Size(50, 0).Match(big) || Size(0, 50).Match(big) || Size(0, 0).Match(dir) {
+		t.Errorf("unexpected Size matches")
+	}
+	if Size(0, 0).Match(filepath.Join(dir, "missing")) {
+		t.Errorf("Size should not match a missing file")
+	}
+	if !And().Match("x") || Or().Match("x") {
+		t.Errorf("unexpected empty combinator matches")
+	}
+
+	if err := validateFilter(Not(Or(Glob("[")))); err == nil {
+		t.Errorf("expected an error for a malformed nested Glob")
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	f := And(Or(Ext(".go", ".mod"), Glob("Makefile")), Not(Hidden()), Not(Glob("*_test.go")))
+	paths := []string{"a/main.go", "a/.main.go", "a/main_test.go", "a/style.css"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.Match(paths[i%len(paths)])
+	}
+}
@@ -0,0 +1,158 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fingerprints maps the assets of a directory to names with a hash of their
+// content, for cache busting, e.g. css/site.css to css/site.3f2a9c1b.css. Use
+// its OnChange as that of a Config watching the directory to keep it up to
+// date, and Name as a template function. Names are slash-separated and
+// relative to the directory. It is safe for concurrent use.
+type Fingerprints struct {
+	// Logger receives the assets that fail to be hashed. If nil,
+	// slog.Default() is used.
+	Logger *slog.Logger
+
+	dir  string
+	file string
+
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+// NewFingerprints hashes every file under dir. If file is not empty, the
+// manifest is written to it as a JSON object after every update; keep it out
+// of dir, or ignore it, so that writing it does not start a cycle.
+func NewFingerprints(dir, file string) (*Fingerprints, error) {
+	f := &Fingerprints{dir: dir, file: file, names: map[string]string{}}
+	if err := f.update(dir); err != nil {
+		return nil, err
+	}
+	return f, f.write()
+}
+
+// Name returns the fingerprinted name of the asset name, or name if it is
+// not known.
+func (f *Fingerprints) Name(name string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if hashed, ok := f.names[name]; ok {
+		return hashed
+	}
+	return name
+}
+
+// Manifest returns a copy of the map of every asset to its fingerprinted
+// name.
+func (f *Fingerprints) Manifest() map[string]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return maps.Clone(f.names)
+}
+
+// OnChange hashes the assets changed in cycle again. It keeps the watcher
+// running if some fail.
+func (f *Fingerprints) OnChange(ctx context.Context, cycle Cycle) bool {
+	log := f.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With("cycle", cycle.ID)
+	for _, p := range cycle.Paths {
+		if err := f.update(p); err != nil {
+			log.Error("failed to fingerprint asset", "path", p, "error", err)
+		}
+	}
+	if err := f.write(); err != nil {
+		log.Error("failed to write fingerprints", "error", err)
+	}
+	return true
+}
+
+// update hashes the files at or under p again, and forgets those that no
+// longer exist.
+func (f *Fingerprints) update(p string) error {
+	rel, err := filepath.Rel(f.dir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil // not an asset
+	}
+	prefix := filepath.ToSlash(rel)
+	f.mu.Lock()
+	for name := range f.names {
+		if prefix == "." || name == prefix || strings.HasPrefix(name, prefix+"/") {
+			delete(f.names, name)
+		}
+	}
+	f.mu.Unlock()
+
+	return filepath.WalkDir(p, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		sum, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(f.dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		ext := path.Ext(name)
+		f.mu.Lock()
+		f.names[name] = strings.TrimSuffix(name, ext) + "." + sum[:8] + ext
+		f.mu.Unlock()
+		return nil
+	})
+}
+
+func hashFile(path string) (string, error) {
+	file, err := openRegular(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// write atomically replaces the manifest file, if any.
+func (f *Fingerprints) write() error {
+	if f.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.Manifest(), "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := f.file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0666); err != nil {
+		return fmt.Errorf("failed to write fingerprints: %w", err)
+	}
+	if err = os.Rename(tmp, f.file); err != nil {
+		return fmt.Errorf("failed to write fingerprints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	asset := filepath.Join(dir, "css", "site.css")
+	if err := os.MkdirAll(filepath.Dir(asset), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(asset, []byte("body {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "assets.json")
+	f, err := NewFingerprints(dir, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := f.Name("css/site.css")
+	if !regexp.MustCompile(`^css/site\.[0-9a-f]{8}\.css$`).MatchString(first) {
+		t.Errorf("unexpected name %q", first)
+	}
+
+	if err := os.WriteFile(asset, []byte("body { margin: 0 }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f.OnChange(context.Background(), Cycle{Paths: []string{asset}})
+	if second := f.Name("css/site.css"); second == first {
+		t.Errorf("the name did not change with the content")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written map[string]string
+	if err := json.Unmarshal(data, &written); err != nil || !maps.Equal(written, f.Manifest()) {
+		t.Errorf("expected the manifest file to match, got %s, %v", data, err)
+	}
+
+	if err := os.RemoveAll(filepath.Dir(asset)); err != nil {
+		t.Fatal(err)
+	}
+	f.OnChange(context.Background(), Cycle{Paths: []string{filepath.Dir(asset)}})
+	if name := f.Name("css/site.css"); name != "css/site.css" {
+		t.Errorf("expected a removed asset to be forgotten, got %q", name)
+	}
+}
@@ -2,6 +2,8 @@ module github.com/infogulch/watch
 
 go 1.21.0
 
-require github.com/fsnotify/fsnotify v1.7.0
-
-require golang.org/x/sys v0.18.0 // indirect
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/sys v0.18.0
+	golang.org/x/text v0.14.0
+)
@@ -0,0 +1,125 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// GoPackages returns the import paths of the packages of the module in dir
+// affected by changes to paths: the packages of the changed .go files, and
+// those that import them, directly or not, or whose tests do. Other paths
+// are skipped. It runs go list, so the go command must be installed.
+func GoPackages(ctx context.Context, dir string, paths []string) ([]string, error) {
+	changed := map[string]bool{} // directories of changed .go files
+	for _, path := range paths {
+		if filepath.Ext(path) != ".go" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		changed[filepath.Dir(abs)] = true
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-json=ImportPath,Dir,Deps,TestImports,XTestImports", "./...")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	type pkg struct {
+		ImportPath   string
+		Dir          string
+		Deps         []string
+		TestImports  []string
+		XTestImports []string
+	}
+	var pkgs []pkg
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p pkg
+		if err := dec.Decode(&p); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode package list: %w", err)
+		}
+		pkgs = append(pkgs, p)
+	}
+
+	// The packages that import a changed one, directly or not, and then
+	// those whose tests import any of these.
+	affected := map[string]bool{}
+	for _, p := range pkgs {
+		if changed[p.Dir] {
+			affected[p.ImportPath] = true
+		}
+	}
+	imports := func(deps []string) bool {
+		return slices.ContainsFunc(deps, func(dep string) bool { return affected[dep] })
+	}
+	for _, p := range pkgs {
+		if imports(p.Deps) {
+			affected[p.ImportPath] = true
+		}
+	}
+	var result []string
+	for _, p := range pkgs {
+		if affected[p.ImportPath] || imports(p.TestImports) || imports(p.XTestImports) {
+			result = append(result, p.ImportPath)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+// GoTest runs go test on the packages GoPackages finds for each cycle, if
+// any. Test output goes to stdout and stderr. Use its OnChange as that of
+// the Config watching the module.
+type GoTest struct {
+	// Dir is the directory of the module.
+	Dir string
+	// Args are more arguments of go test, such as "-short".
+	Args []string
+	// Logger receives the failures of go test. If nil, slog.Default() is
+	// used.
+	Logger *slog.Logger
+}
+
+// OnChange runs go test for cycle. It always keeps the watcher running.
+func (t GoTest) OnChange(ctx context.Context, cycle Cycle) bool {
+	log := t.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With("cycle", cycle.ID)
+	pkgs, err := GoPackages(ctx, t.Dir, cycle.Paths)
+	if err != nil {
+		log.Error("failed to find affected packages", "error", err)
+		return true
+	}
+	if len(pkgs) == 0 {
+		return true
+	}
+	cmd := exec.CommandContext(ctx, "go", append(append([]string{"test"}, t.Args...), pkgs...)...)
+	cmd.Dir = t.Dir
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Error("go test failed", "packages", pkgs, "error", err)
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGoPackages(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not installed")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module m\n\ngo 1.21\n",
+		"a/a.go":      "package a\n",
+		"b/b.go":      "package b\n\nimport _ \"m/a\"\n",
+		"c/c.go":      "package c\n",
+		"c/c_test.go": "package c\n\nimport _ \"m/b\"\n",
+		"d/d.go":      "package d\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for changed, want := range map[string][]string{
+		"a/a.go":      {"m/a", "m/b", "m/c"},
+		"b/b.go":      {"m/b", "m/c"},
+		"c/c_test.go": {"m/c"},
+		"d/README":    nil,
+	} {
+		got, err := GoPackages(context.Background(), dir, []string{filepath.Join(dir, filepath.FromSlash(changed))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", changed, want, got)
+		}
+	}
+}
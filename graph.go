@@ -0,0 +1,147 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Target is a named step of a Graph.
+type Target struct {
+	// Name identifies the target in Deps and in errors.
+	Name string
+	// Paths are the files and directories whose changes trigger the target
+	// directly. A changed path triggers the target if it is one of Paths or
+	// is under one of them.
+	Paths []string
+	// Deps are the names of the targets this one depends on. The target runs
+	// after them and whenever any of them runs.
+	Deps []string
+	// Run performs the step.
+	Run func(ctx context.Context) error
+}
+
+// Graph runs the targets affected by a set of changed paths, in dependency
+// order. For example, with targets regen (Paths: proto), build (Deps: regen)
+// and restart (Deps: build), a change under proto runs regen, build and
+// restart, while a change that only matches build's Paths runs build and
+// restart.
+type Graph struct {
+	order      []*Target           // topologically sorted
+	dependents map[string][]string // name -> names of targets that depend on it
+}
+
+// NewGraph checks that every dependency exists and that there are no cycles.
+func NewGraph(targets ...Target) (*Graph, error) {
+	byName := map[string]*Target{}
+	for i := range targets {
+		t := &targets[i]
+		if _, ok := byName[t.Name]; ok {
+			return nil, fmt.Errorf("duplicate target %q", t.Name)
+		}
+		if t.Run == nil {
+			return nil, fmt.Errorf("target %q has nil Run", t.Name)
+		}
+		byName[t.Name] = t
+	}
+
+	g := &Graph{dependents: map[string][]string{}}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(t *Target, path []string) error
+	visit = func(t *Target, path []string) error {
+		switch state[t.Name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, t.Name), " -> "))
+		case done:
+			return nil
+		}
+		state[t.Name] = visiting
+		for _, dep := range t.Deps {
+			d, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("target %q depends on unknown target %q", t.Name, dep)
+			}
+			if err := visit(d, append(path, t.Name)); err != nil {
+				return err
+			}
+		}
+		state[t.Name] = done
+		g.order = append(g.order, t)
+		return nil
+	}
+	for i := range targets {
+		if err := visit(&targets[i], nil); err != nil {
+			return nil, err
+		}
+		for _, dep := range targets[i].Deps {
+			g.dependents[dep] = append(g.dependents[dep], targets[i].Name)
+		}
+	}
+	return g, nil
+}
+
+// Plan returns the names of the targets to run for the changed paths, in the
+// order they would run: every target triggered directly by a path, and every
+// target that depends on one of those, transitively.
+func (g *Graph) Plan(paths []string) []string {
+	run := map[string]bool{}
+	var mark func(name string)
+	mark = func(name string) {
+		if run[name] {
+			return
+		}
+		run[name] = true
+		for _, d := range g.dependents[name] {
+			mark(d)
+		}
+	}
+	for _, t := range g.order {
+		if t.triggeredBy(paths) {
+			mark(t.Name)
+		}
+	}
+
+	var plan []string
+	for _, t := range g.order {
+		if run[t.Name] {
+			plan = append(plan, t.Name)
+		}
+	}
+	return plan
+}
+
+// Run runs the targets planned for the changed paths, in order. It stops at
+// the first target that fails and returns its error.
+func (g *Graph) Run(ctx context.Context, paths []string) error {
+	plan := map[string]bool{}
+	for _, name := range g.Plan(paths) {
+		plan[name] = true
+	}
+	for _, t := range g.order {
+		if !plan[t.Name] {
+			continue
+		}
+		if err := t.Run(ctx); err != nil {
+			return fmt.Errorf("target %q failed: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func (t *Target) triggeredBy(paths []string) bool {
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		for _, p := range t.Paths {
+			p = filepath.Clean(p)
+			if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) || p == "." {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	var ran []string
+	target := func(name string, paths []string, deps ...string) Target {
+		return Target{Name: name, Paths: paths, Deps: deps, Run: func(context.Context) error {
+			ran = append(ran, name)
+			if name == "fail" {
+				return errors.New("failed")
+			}
+			return nil
+		}}
+	}
+	g, err := NewGraph(
+		target("restart", nil, "build"),
+		target("build", []string{"cmd", "internal"}, "regen"),
+		target("regen", []string{"proto"}),
+		target("docs", []string{"docs"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		paths []string
+		want  []string
+	}{
+		{[]string{"proto/api.proto"}, []string{"regen", "build", "restart"}},
+		{[]string{"internal/x.go"}, []string{"build", "restart"}},
+		{[]string{"docs/index.md", "cmd/main.go"}, []string{"build", "restart", "docs"}},
+		{[]string{"protobuf/x"}, nil},
+	} {
+		if got := g.Plan(tc.paths); !slices.Equal(got, tc.want) {
+			t.Errorf("Plan(%q) = %q, want %q", tc.paths, got, tc.want)
+		}
+		ran = nil
+		if err := g.Run(context.Background(), tc.paths); err != nil {
+			t.Errorf("Run(%q): %v", tc.paths, err)
+		}
+		if !slices.Equal(ran, tc.want) {
+			t.Errorf("Run(%q) ran %q, want %q", tc.paths, ran, tc.want)
+		}
+	}
+
+	g, err = NewGraph(target("fail", []string{"a"}), target("after", nil, "fail"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran = nil
+	if err := g.Run(context.Background(), []string{"a"}); err == nil || !slices.Equal(ran, []string{"fail"}) {
+		t.Errorf("expected Run to stop at the failing target, got %v after %q", err, ran)
+	}
+
+	if _, err := NewGraph(target("a", nil, "b"), target("b", nil, "a")); err == nil {
+		t.Errorf("expected cycle error")
+	}
+	if _, err := NewGraph(target("a", nil, "missing")); err == nil {
+		t.Errorf("expected unknown dependency error")
+	}
+}
@@ -0,0 +1,82 @@
+package watch
+
+import "path/filepath"
+
+// ignoreMatcher matches base names against a list of Ignore patterns at
+// once, so that thousands of them, e.g. from nested .gitignore files, don't
+// cost a filepath.Match each per event. Literal names are looked up in a
+// map, "*suffix" and "prefix*" patterns with a map lookup per suffix or
+// prefix of the name, and only the other patterns are matched one by one.
+type ignoreMatcher struct {
+	patterns []string       // as given, to report
+	exact    map[string]int // -> index of the first pattern
+	suffix   map[string]int
+	prefix   map[string]int
+	other    []int    // indexes of the patterns matched one by one, in order
+	normed   []string // the patterns with normPath
+}
+
+func compileIgnore(patterns []string) *ignoreMatcher {
+	m := &ignoreMatcher{
+		patterns: patterns,
+		exact:    map[string]int{},
+		suffix:   map[string]int{},
+		prefix:   map[string]int{},
+		normed:   make([]string, len(patterns)),
+	}
+	first := func(index map[string]int, key string, i int) {
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+	for i, pattern := range patterns {
+		p := normPath(pattern)
+		m.normed[i] = p
+		switch {
+		case !hasMeta(p):
+			first(m.exact, p, i)
+		case p[0] == '*' && !hasMeta(p[1:]):
+			first(m.suffix, p[1:], i)
+		case p[len(p)-1] == '*' && !hasMeta(p[:len(p)-1]):
+			first(m.prefix, p[:len(p)-1], i)
+		default:
+			m.other = append(m.other, i)
+		}
+	}
+	return m
+}
+
+// match returns the first pattern that matches base, or "" if none does.
+func (m *ignoreMatcher) match(base string) string {
+	best := len(m.patterns)
+	if i, ok := m.exact[base]; ok {
+		best = i
+	}
+	if len(m.suffix) > 0 {
+		for j := 0; j <= len(base); j++ {
+			if i, ok := m.suffix[base[j:]]; ok && i < best {
+				best = i
+			}
+		}
+	}
+	if len(m.prefix) > 0 {
+		for j := 0; j <= len(base); j++ {
+			if i, ok := m.prefix[base[:j]]; ok && i < best {
+				best = i
+			}
+		}
+	}
+	for _, i := range m.other {
+		if i >= best {
+			break
+		}
+		if ok, _ := filepath.Match(m.normed[i], base); ok {
+			best = i
+			break
+		}
+	}
+	if best == len(m.patterns) {
+		return ""
+	}
+	return m.patterns[best]
+}
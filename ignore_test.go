@@ -0,0 +1,48 @@
+package watch
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	patterns := []string{"node_modules", "*.tmp", "~*", "*", "a?c", "[", "*.go", "build*"}
+	names := []string{"node_modules", "x.tmp", ".tmp", "~x.tmp", "main.go", "abc", "build.go", "buildx", "other"}
+	for n := range patterns {
+		m := compileIgnore(patterns[n:])
+		for _, name := range names {
+			want := ""
+			for _, p := range patterns[n:] {
+				if ok, _ := filepath.Match(p, name); ok {
+					want = p
+					break
+				}
+			}
+			if got := m.match(name); got != want {
+				t.Errorf("patterns %q: expected %q to match %q, got %q", patterns[n:], name, want, got)
+			}
+		}
+	}
+}
+
+func BenchmarkIgnore(b *testing.B) {
+	var patterns []string
+	for i := 0; i < 1000; i++ {
+		patterns = append(patterns, fmt.Sprintf("generated%d", i), fmt.Sprintf("*.ext%d", i), fmt.Sprintf("tmp%d*", i))
+	}
+	names := []string{"main.go", "generated500", "file.ext999", "README"}
+	c := Config{Ignore: patterns}
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c.ignoredBy(names[i%len(names)])
+		}
+	})
+	c.ignore = compileIgnore(patterns)
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.ignoredBy(names[i%len(names)])
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package watch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// appendJournal appends c to the journal file at path as a line of JSON.
+func appendJournal(path string, c Cycle) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return f.Close()
+}
+
+// Replay calls onchange again for every cycle recorded in the journal file at
+// path (see Config.Journal) whose Time is in [from, to). A zero from or to
+// leaves that end of the range open. Replay stops when onchange returns
+// false or ctx is done.
+//
+// Replayed cycles are as they were recorded, with their original ID, Start,
+// Time, Paths, Changes, Diffs and Stats. Journals written before Start,
+// Changes and Stats were recorded replay without them. IDs restart at 1 every
+// time the process starts, so they are only unique together with Time.
+func Replay(ctx context.Context, path string, from, to time.Time, onchange func(ctx context.Context, c Cycle) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var cycle Cycle
+		if err := json.Unmarshal(scanner.Bytes(), &cycle); err != nil {
+			return fmt.Errorf("invalid journal entry at %s:%d: %w", path, line, err)
+		}
+		if (!from.IsZero() && cycle.Time.Before(from)) || (!to.IsZero() && !cycle.Time.Before(to)) {
+			continue
+		}
+		if !onchange(ctx, cycle) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package watch
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestJournalReplay(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle)
+	journal := filepath.Join(t.TempDir(), "journal")
+
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.Journal = journal
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []Cycle
+	for _, name := range []string{"a", "b", "c"} {
+		events <- fsnotify.Event{Name: name, Op: fsnotify.Write}
+		recorded = append(recorded, <-cycles)
+	}
+	halt <- struct{}{}
+
+	var replayed []string
+	var replayedCycles []Cycle
+	replay := func(from, to time.Time) {
+		replayed, replayedCycles = nil, nil
+		err := Replay(context.Background(), journal, from, to, func(_ context.Context, cycle Cycle) bool {
+			replayed = append(replayed, cycle.Paths...)
+			replayedCycles = append(replayedCycles, cycle)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replay(time.Time{}, time.Time{})
+	if !slices.Equal(replayed, []string{"a", "b", "c"}) {
+		t.Errorf("replayed %q, want all cycles", replayed)
+	}
+	for i, cycle := range replayedCycles {
+		want := recorded[i]
+		if cycle.ID != want.ID || !cycle.Start.Equal(want.Start) || !reflect.DeepEqual(cycle.Changes, want.Changes) {
+			t.Errorf("replayed %+v, want %+v", cycle, want)
+		}
+	}
+	replay(recorded[1].Time, recorded[2].Time)
+	if !slices.Equal(replayed, []string{"b"}) {
+		t.Errorf("replayed %q, want only the second cycle", replayed)
+	}
+}
+
+func TestJournalInDirs(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle)
+	dir := t.TempDir()
+
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 0
+	c.Journal = filepath.Join(dir, "journal")
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	events <- fsnotify.Event{Name: c.Journal, Op: fsnotify.Write}
+	a := filepath.Join(dir, "a")
+	events <- fsnotify.Event{Name: a, Op: fsnotify.Write}
+	if cycle := <-cycles; !slices.Equal(cycle.Paths, []string{a}) {
+		t.Errorf("expected the journal's own writes to be dropped, got %v", cycle.Paths)
+	}
+}
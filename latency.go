@@ -0,0 +1,118 @@
+package watch
+
+import (
+	"sync"
+	"time"
+)
+
+// Latency records how long the cycles of a watcher take, as set in
+// Config.Latency, e.g. to tune Config.Debounce. It is safe for concurrent
+// use.
+type Latency struct {
+	mu       sync.Mutex
+	debounce Histogram
+	callback Histogram
+}
+
+// Debounce returns the distribution of the time from the first event of a
+// cycle to the call to OnChange. Cycles without events, with Config.Initial
+// or Config.Manifest, are not included.
+func (l *Latency) Debounce() Histogram {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.debounce.clone()
+}
+
+// Callback returns the distribution of the time OnChange takes to return.
+func (l *Latency) Callback() Histogram {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.callback.clone()
+}
+
+func (l *Latency) observe(debounce, callback time.Duration, events bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if events {
+		l.debounce.observe(debounce)
+	}
+	l.callback.observe(callback)
+}
+
+// latencyBounds are the upper bounds of the buckets of a Histogram: powers of
+// two from 1ms to about 65s.
+var latencyBounds = func() []time.Duration {
+	bounds := make([]time.Duration, 17)
+	for i := range bounds {
+		bounds[i] = time.Millisecond << i
+	}
+	return bounds
+}()
+
+// Histogram is a distribution of durations.
+type Histogram struct {
+	// Bounds are the inclusive upper bounds of the buckets, increasing.
+	Bounds []time.Duration
+	// Counts are the number of durations in each bucket: Counts[i] are at
+	// most Bounds[i] and greater than Bounds[i-1]. The last one, at
+	// Counts[len(Bounds)], counts the durations greater than every bound.
+	Counts []uint64
+	// Count is the number of durations.
+	Count uint64
+	// Sum is the sum of the durations.
+	Sum time.Duration
+	// Max is the longest duration.
+	Max time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Bounds = latencyBounds
+		h.Counts = make([]uint64, len(latencyBounds)+1)
+	}
+	i := 0
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	h.Max = max(h.Max, d)
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// Mean returns the average duration, or 0 if there is none.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns an upper bound of the q-quantile, for q between 0 and 1,
+// e.g. 0.99 for the 99th percentile: the bound of the bucket it is in, or Max
+// if that is lower. It returns 0 if there is no duration.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	if rank >= h.Count {
+		rank = h.Count - 1
+	}
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen > rank {
+			if i < len(h.Bounds) {
+				return min(h.Bounds[i], h.Max)
+			}
+			break
+		}
+	}
+	return h.Max
+}
@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	if h.Quantile(0.5) != 0 || h.Mean() != 0 {
+		t.Errorf("expected zeros for an empty histogram")
+	}
+	for _, d := range []time.Duration{500 * time.Microsecond, 3 * time.Millisecond, 3 * time.Millisecond, 5 * time.Millisecond, 2 * time.Minute} {
+		h.observe(d)
+	}
+	if h.Count != 5 || h.Max != 2*time.Minute || h.Counts[0] != 1 || h.Counts[2] != 2 || h.Counts[len(h.Bounds)] != 1 {
+		t.Errorf("unexpected histogram %+v", h)
+	}
+	if q := h.Quantile(0.5); q != 4*time.Millisecond {
+		t.Errorf("expected a median of at most 4ms, got %v", q)
+	}
+	if q := h.Quantile(1); q != 2*time.Minute {
+		t.Errorf("expected the maximum, got %v", q)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 10 * time.Millisecond
+	c.Initial = true
+	c.Latency = &Latency{}
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	n := 0
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		time.Sleep(time.Millisecond)
+		cycles <- cycle
+		n += 1
+		return n < 2
+	}
+	done := make(chan error)
+	go func() { done <- c.Run(context.Background()) }()
+	<-cycles
+	events <- fsnotify.Event{Name: "a"}
+	if cycle := <-cycles; cycle.Time.Sub(cycle.Start) < c.Debounce {
+		t.Errorf("expected the cycle to last at least the debounce delay, got %+v", cycle)
+	}
+	<-done
+
+	if d := c.Latency.Debounce(); d.Count != 1 || d.Max < c.Debounce {
+		t.Errorf("expected one debounce of at least %v, got %+v", c.Debounce, d)
+	}
+	if cb := c.Latency.Callback(); cb.Count != 2 || cb.Max < time.Millisecond {
+		t.Errorf("expected two callbacks, got %+v", cb)
+	}
+}
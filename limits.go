@@ -0,0 +1,92 @@
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"runtime"
+)
+
+// watchLimitWarn is the share of the system's limit on watches above which a
+// watch set is logged as approaching it.
+const watchLimitWarn = 0.8
+
+// checkWatchLimit warns when a watch set of n directories comes close to the
+// system's limit on watches, or failed to be established because of it, with
+// the command that raises the limit. With c.RaiseWatchLimit and raise set,
+// it raises the limit instead, and reports whether it did.
+func (c Config) checkWatchLimit(log *slog.Logger, n int, err error, failed []*fs.PathError, raise bool) bool {
+	limit := watchLimit()
+	if limit == 0 {
+		return false
+	}
+	full := isWatchLimit(err)
+	for _, err := range failed {
+		full = full || isWatchLimit(err.Err)
+	}
+	if !full && float64(n) < watchLimitWarn*float64(limit) {
+		return false
+	}
+	want := max(2*limit, 2*n)
+	if c.RaiseWatchLimit && raise {
+		err := setWatchLimit(want)
+		if err == nil {
+			log.Info("raised the system's limit on watches", "from", limit, "to", want)
+			return true
+		}
+		log.Info("failed to raise the system's limit on watches", "error", err)
+	}
+	msg := "approaching the system's limit on watches"
+	if full {
+		msg = "reached the system's limit on watches"
+	}
+	log.Warn(msg, "watches", n, "limit", limit, "fix", fmt.Sprintf("sysctl fs.inotify.max_user_watches=%d", want))
+	return false
+}
+
+// kqueue is whether fsnotify uses kqueue, which takes a file descriptor for
+// every watched directory and every file in it.
+const kqueue = runtime.GOOS == "darwin" || runtime.GOOS == "dragonfly" || runtime.GOOS == "freebsd" ||
+	runtime.GOOS == "netbsd" || runtime.GOOS == "openbsd"
+
+// checkDescriptors warns when a watch set of n directories failed to be
+// established, or err failed to create its watcher, because the process ran
+// out of file descriptors, with how many it needed and the limit. It reports
+// whether to fall back to polling, which takes no descriptors per directory:
+// with c.AllowPartial, the directories left out are listed as failed
+// instead.
+func (c Config) checkDescriptors(log *slog.Logger, n int, err error, failed []*fs.PathError) bool {
+	full := isDescriptorLimit(err)
+	for _, err := range failed {
+		full = full || isDescriptorLimit(err.Err)
+	}
+	if !full {
+		return false
+	}
+	needed := c.descriptorsNeeded()
+	limit := descriptorLimit()
+	args := []any{"added", n, "needed", needed, "limit", limit}
+	if limit > 0 {
+		args = append(args, "fix", fmt.Sprintf("ulimit -n %d", max(2*limit, limit+needed)))
+	}
+	if c.AllowPartial && err == nil {
+		log.Warn("ran out of file descriptors, some directories are not watched", args...)
+		return false
+	}
+	log.Warn("ran out of file descriptors, polling instead", args...)
+	return true
+}
+
+// descriptorsNeeded returns about how many file descriptors fsnotify takes
+// to watch the directories of c.
+func (c Config) descriptorsNeeded() int {
+	w, _ := c.walk(func(string) error { return nil }, nil)
+	n := w.added.len()
+	if kqueue {
+		c.walkFiles(func(string, fs.DirEntry) error {
+			n += 1
+			return nil
+		})
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package watch
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// maxUserWatches is the inotify limit on watches per user.
+const maxUserWatches = "/proc/sys/fs/inotify/max_user_watches"
+
+// watchLimit returns the system's limit on watches, or 0 if it is unknown.
+func watchLimit() int {
+	b, err := os.ReadFile(maxUserWatches)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return n
+}
+
+// setWatchLimit sets the system's limit on watches to n, which takes root.
+func setWatchLimit(n int) error {
+	return os.WriteFile(maxUserWatches, []byte(strconv.Itoa(n)+"\n"), 0)
+}
+
+// isWatchLimit reports whether err is inotify_add_watch failing because the
+// limit on watches is reached.
+func isWatchLimit(err error) bool {
+	return err != nil && errors.Is(err, syscall.ENOSPC)
+}
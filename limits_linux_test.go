@@ -0,0 +1,66 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCheckWatchLimit(t *testing.T) {
+	limit := watchLimit()
+	if limit == 0 {
+		t.Skip("the limit on watches is unknown on this system")
+	}
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	c := Config{}
+
+	c.checkWatchLimit(log, 1, nil, nil, true)
+	if buf.Len() != 0 {
+		t.Errorf("unexpected warning far from the limit: %s", buf.String())
+	}
+
+	fix := fmt.Sprintf("sysctl fs.inotify.max_user_watches=%d", 2*limit)
+	c.checkWatchLimit(log, limit, nil, nil, true)
+	if !strings.Contains(buf.String(), "approaching") || !strings.Contains(buf.String(), fix) {
+		t.Errorf("expected a warning with %q, got %s", fix, buf.String())
+	}
+
+	buf.Reset()
+	c.checkWatchLimit(log, 1, fmt.Errorf("add: %w", syscall.ENOSPC), nil, true)
+	if !strings.Contains(buf.String(), "reached") {
+		t.Errorf("expected a warning for a full watch set, got %s", buf.String())
+	}
+}
+
+func TestCheckDescriptors(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	c := Config{Dirs: []string{t.TempDir()}}
+
+	if c.checkDescriptors(log, 1, nil, nil) || buf.Len() != 0 {
+		t.Errorf("unexpected fallback or warning: %s", buf.String())
+	}
+
+	emfile := fmt.Errorf("add: %w", syscall.EMFILE)
+	if !c.checkDescriptors(log, 1, emfile, nil) {
+		t.Errorf("expected to fall back to polling")
+	}
+	if out := buf.String(); !strings.Contains(out, "polling instead") || !strings.Contains(out, "needed=1") {
+		t.Errorf("expected a warning with the descriptors needed, got %s", out)
+	}
+
+	buf.Reset()
+	c.AllowPartial = true
+	failed := []*fs.PathError{{Op: "add", Path: c.Dirs[0], Err: emfile}}
+	if c.checkDescriptors(log, 0, nil, failed) {
+		t.Errorf("unexpected fallback with AllowPartial")
+	}
+	if out := buf.String(); !strings.Contains(out, "not watched") {
+		t.Errorf("expected a warning for a partial watch set, got %s", out)
+	}
+}
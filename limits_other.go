@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// watchLimit returns 0: the limit on watches is only known on Linux.
+func watchLimit() int { return 0 }
+
+func setWatchLimit(n int) error { return errors.ErrUnsupported }
+
+func isWatchLimit(err error) bool { return false }
@@ -0,0 +1,136 @@
+package watch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// racyListing is how long after its modification time a directory must have
+// been listed for the listing to be reused. A directory changed within the
+// same tick of a coarse clock as it was listed would otherwise keep its
+// modification time, and the change would be missed.
+const racyListing = 2 * time.Second
+
+// listings keeps the subdirectories and symlinks of the directories walked
+// to rebuild the watch set. Adding or removing an entry changes the
+// modification time of its directory, so a directory whose time and identity
+// didn't change since it was listed is not read again: a rescan then costs a
+// stat per directory instead of reading every one of them.
+type listings struct {
+	m   map[string]*listing
+	gen uint64 // of the current full walk, to prune the others
+}
+
+type listing struct {
+	id      fileID
+	mtime   time.Time
+	entries []fs.DirEntry // only directories and symlinks, sorted by name
+	gen     uint64
+}
+
+func newListings() *listings {
+	return &listings{m: map[string]*listing{}}
+}
+
+// read returns the directories and symlinks in dir, reading it only if it
+// changed since it was last read. Listings are not kept unless
+// reuseListings.
+func (l *listings) read(dir string, info fs.FileInfo) ([]fs.DirEntry, error) {
+	if !reuseListings {
+		return readDirs(dir)
+	}
+	id := fileIDOf(info)
+	if cached, ok := l.m[dir]; ok && sameFile(cached.id, id) && cached.mtime.Equal(info.ModTime()) {
+		cached.gen = l.gen
+		return cached.entries, nil
+	}
+	listed := time.Now()
+	entries, err := readDirs(dir)
+	if err != nil || listed.Sub(info.ModTime()) < racyListing {
+		delete(l.m, dir)
+		return entries, err
+	}
+	l.m[dir] = &listing{id: id, mtime: info.ModTime(), entries: entries, gen: l.gen}
+	return entries, nil
+}
+
+// readDirs returns the directories and symlinks in dir.
+func readDirs(dir string) ([]fs.DirEntry, error) {
+	all, err := os.ReadDir(dir)
+	var entries []fs.DirEntry
+	for _, e := range all {
+		if e.IsDir() || e.Type()&fs.ModeSymlink != 0 {
+			entries = append(entries, e)
+		}
+	}
+	return entries, err
+}
+
+// prune forgets the directories not walked since the last prune, e.g.
+// because they were removed.
+func (l *listings) prune() {
+	for dir, cached := range l.m {
+		if cached.gen != l.gen {
+			delete(l.m, dir)
+		}
+	}
+	l.gen += 1
+}
+
+// walk is filepath.WalkDir, except that fn is only called for directories
+// and symlinks, and listings are reused.
+func (l *listings) walk(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = l.walkDir(root, fs.FileInfoToDirEntry(info), info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (l *listings) walkDir(path string, d fs.DirEntry, info fs.FileInfo, fn fs.WalkDirFunc) error {
+	if info == nil && d.IsDir() {
+		// d may be cached, so check what path is now.
+		var err error
+		if info, err = os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			return nil // removed since its parent was listed
+		} else if err != nil {
+			if err = fn(path, d, err); err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+		d = fs.FileInfoToDirEntry(info)
+	}
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := l.read(path, info)
+	if err != nil {
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range entries {
+		if err := l.walkDir(filepath.Join(path, e.Name()), e, nil, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
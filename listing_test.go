@@ -0,0 +1,86 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestListings(t *testing.T) {
+	if !reuseListings {
+		t.Skip("listings are not kept on " + runtime.GOOS)
+	}
+	root := t.TempDir()
+	path := func(elems ...string) string { return filepath.Join(append([]string{root}, elems...)...) }
+	for _, dir := range []string{path("a", "b"), path("a", "c"), path("d"), path(".git")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	age := func(dirs ...string) {
+		t.Helper()
+		for _, dir := range dirs {
+			if err := os.Chtimes(dir, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	age(path(), path("a"), path("a", "b"), path("a", "c"), path("d"))
+
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	c.listings = newListings()
+	walk := func() []string {
+		t.Helper()
+		var dirs []string
+		if _, err := c.walk(func(dir string) error {
+			dirs = append(dirs, dir)
+			return nil
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+		c.listings.prune()
+		slices.Sort(dirs)
+		return dirs
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		slices.Sort(want)
+		if got := walk(); !slices.Equal(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	expect(path(), path("a"), path("a", "b"), path("a", "c"), path("d"))
+	if _, ok := c.listings.m[path("a")]; !ok {
+		t.Errorf("the listing of %s was not kept", path("a"))
+	}
+
+	// A new directory changes the time of its parent, and the new
+	// directory is too recent to be kept.
+	if err := os.Mkdir(path("a", "b", "e"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	expect(path(), path("a"), path("a", "b"), path("a", "b", "e"), path("a", "c"), path("d"))
+	if _, ok := c.listings.m[path("a", "b")]; ok {
+		t.Errorf("the recent listing of %s was kept", path("a", "b"))
+	}
+
+	// A directory replaced by a file is seen even if its parent's listing
+	// is reused, and the listings of removed directories are pruned.
+	if err := os.Remove(path("d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("d"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	age(path())
+	expect(path(), path("a"), path("a", "b"), path("a", "b", "e"), path("a", "c"))
+	if _, ok := c.listings.m[path("d")]; ok {
+		t.Errorf("the listing of the removed %s was kept", path("d"))
+	}
+}
@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogFunc is a minimal logging function, for logging libraries without a
+// slog.Handler. attrs are the attributes of the line, including those the
+// logger was created with.
+type LogFunc func(level slog.Level, msg string, attrs []slog.Attr)
+
+// NewLogHandler returns a slog.Handler that calls log for every line at
+// level or above, for use as slog.New(NewLogHandler(...)) in Config.Logger.
+// Attributes in groups have their keys prefixed with the group names and a
+// dot.
+//
+// The watcher logs through Config.Logger with these attributes, whether it
+// uses this handler or any other slog.Handler, e.g. a bridge to zap, zerolog
+// or logr:
+//
+//   - "cycle": the ID of the cycle a line belongs to, on every line from the
+//     first event of a cycle until the watch set is rebuilt.
+//   - "error": the error of a failure, on lines at info and warn level, and
+//     on the final "watcher stopped" line.
+//   - "path", "op", "time", "action" and "pattern", "filter" or "reason":
+//     every event, on "event" lines at debug level with Config.Trace.
+//   - "count" and "rootdirs": the size of a new watch set and its roots.
+//   - "duration", "delay", "attempt", "interval", "max" and "uncovered": the
+//     debounce delay, the delay before a retry and the number of the restart
+//     it comes before, the polling interval of a root on a 9p mount or of
+//     the directories polled with Config.PollUncovered, and the directories
+//     left out by Config.MaxDirs.
+//   - "watches", "limit" and "fix", or "from" and "to": the system's limit on
+//     watches when it is close, and the command that raises it, or how it
+//     was raised with Config.RaiseWatchLimit.
+//   - "added", "needed", "limit" and "fix": the directories watched when the
+//     process ran out of file descriptors, about how many the watch set
+//     takes, the process's limit on them, and the command that raises it.
+//
+// Events and routine progress are logged at debug level, recovered failures
+// at info level, and incomplete watch sets at warn level.
+func NewLogHandler(level slog.Leveler, log LogFunc) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &logHandler{level: level, log: log}
+}
+
+type logHandler struct {
+	level  slog.Leveler
+	log    LogFunc
+	attrs  []slog.Attr
+	prefix string // of the keys of the attributes of the current group
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, len(h.attrs), len(h.attrs)+r.NumAttrs())
+	copy(attrs, h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = h.append(attrs, a)
+		return true
+	})
+	h.log(r.Level, r.Message, attrs)
+	return nil
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = h.attrs[:len(h.attrs):len(h.attrs)]
+	for _, a := range attrs {
+		h2.attrs = h.append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// append appends a to attrs with the current group prefix, flattening groups.
+func (h *logHandler) append(attrs []slog.Attr, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		sub := *h
+		if a.Key != "" {
+			sub.prefix = h.prefix + a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			attrs = sub.append(attrs, ga)
+		}
+		return attrs
+	}
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	a.Key = h.prefix + a.Key
+	return append(attrs, a)
+}
@@ -0,0 +1,32 @@
+package watch
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+func TestNewLogHandler(t *testing.T) {
+	var lines []string
+	log := slog.New(NewLogHandler(slog.LevelInfo, func(level slog.Level, msg string, attrs []slog.Attr) {
+		line := fmt.Sprint(level, " ", msg)
+		for _, a := range attrs {
+			line += fmt.Sprintf(" %s=%v", a.Key, a.Value)
+		}
+		lines = append(lines, line)
+	}))
+
+	clog := log.With("cycle", 3)
+	clog.Debug("event", "path", "a")
+	clog.Info("watcher error", "error", "boom")
+	clog.WithGroup("g").Warn("grouped", "k", 1, slog.Group("sub", "x", 2))
+
+	want := []string{
+		"INFO watcher error cycle=3 error=boom",
+		"WARN grouped cycle=3 g.k=1 g.sub.x=2",
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("expected %q, got %q", want, lines)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package watch
+
+// longPath returns path as is: only Windows limits the length of paths.
+func longPath(path string) string { return path }
+
+// shortPath returns path as is: longPath adds no prefix.
+func shortPath(path string) string { return path }
@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the longest path, MAX_PATH less room for a file name, that
+// Windows APIs accept without the extended-length prefix. The os package
+// adds the prefix itself, so only paths given to fsnotify need it.
+const maxPath = 248
+
+// longPath returns path in extended-length form, `\\?\C:\dir` or
+// `\\?\UNC\server\share\dir`, if it is too long for the Windows APIs.
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// shortPath strips the extended-length prefix that longPath adds. The path
+// stays absolute if longPath made it so; walked.short makes it relative
+// again.
+func shortPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(path, `\\?\`)
+}
@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := `C:\` + strings.Repeat(`node_modules\`, 30) + "x"
+	unc := `\\server\share\` + strings.Repeat(`node_modules\`, 30) + "x"
+	for path, want := range map[string]string{
+		`C:\short`: `C:\short`,
+		long:       `\\?\` + long,
+		unc:        `\\?\UNC\server\share\` + strings.Repeat(`node_modules\`, 30) + "x",
+	} {
+		if got := longPath(path); got != want {
+			t.Errorf("longPath(%q) = %q, want %q", path, got, want)
+		}
+		if got := shortPath(longPath(path)); got != path {
+			t.Errorf("shortPath(longPath(%q)) = %q", path, got)
+		}
+	}
+}
+
+func TestWalkedShort(t *testing.T) {
+	deep := strings.Repeat(`node_modules\`, 30) + "x"
+	w := walked{relative: [][2]string{{`C:\work\src`, "src"}}}
+	for path, want := range map[string]string{
+		`\\?\C:\work\src\` + deep:  `src\` + deep,
+		`\\?\C:\elsewhere\` + deep: `C:\elsewhere\` + deep,
+		`src\short`:                `src\short`,
+	} {
+		if got := w.short(path); got != want {
+			t.Errorf("short(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
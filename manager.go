@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Manager runs a set of named watchers, each with its own Config, and lets
+// them be started, stopped and reloaded individually. The watchers are
+// removed from the set once they stop on their own. Set Config.Share for
+// them to share a single fsnotify.Watcher. The zero value is an empty
+// Manager ready to use. A Manager is safe for concurrent use.
+type Manager struct {
+	mu sync.Mutex
+	// running maps the names of the watchers to them, or to nil while they
+	// are being started.
+	running map[string]*Watcher
+}
+
+// Start starts watching c under name. It fails if name is already running.
+func (m *Manager) Start(name string, c Config) error {
+	m.mu.Lock()
+	if _, ok := m.running[name]; ok {
+		m.mu.Unlock()
+		return fmt.Errorf("watch %q is already running", name)
+	}
+	if m.running == nil {
+		m.running = map[string]*Watcher{}
+	}
+	m.running[name] = nil // taken while the initial walk runs unlocked
+	m.mu.Unlock()
+
+	w, err := c.Start()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.running[name]
+	if err != nil {
+		if ok && cur == nil {
+			delete(m.running, name)
+		}
+		return fmt.Errorf("failed to start watch %q: %w", name, err)
+	}
+	if !ok || cur != nil {
+		w.Halt() // stopped or reloaded while starting
+		return nil
+	}
+	m.set(name, w)
+	return nil
+}
+
+// Stop halts the watcher running under name. It returns false if there is
+// none.
+func (m *Manager) Stop(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.running[name]
+	if ok {
+		if w != nil {
+			w.Halt()
+		}
+		delete(m.running, name)
+	}
+	return ok
+}
+
+// Reload replaces the watcher running under name with one for c, or starts
+// it if it is not running. The new watcher is established before the old one
+// is halted, so no change is missed; if it fails to start, the old one keeps
+// running.
+func (m *Manager) Reload(name string, c Config) error {
+	w, err := c.Start()
+	if err != nil {
+		return fmt.Errorf("failed to reload watch %q: %w", name, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old := m.running[name]; old != nil {
+		old.Halt()
+	}
+	if m.running == nil {
+		m.running = map[string]*Watcher{}
+	}
+	m.set(name, w)
+	return nil
+}
+
+// Names returns the sorted names of the running watchers.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.running))
+	for name := range m.running {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// StopAll halts every running watcher.
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, w := range m.running {
+		if w != nil {
+			w.Halt()
+		}
+		delete(m.running, name)
+	}
+}
+
+// set records w under name, and removes it once it stops, unless it was
+// replaced by then. m.mu must be held.
+func (m *Manager) set(name string, w *Watcher) {
+	m.running[name] = w
+	go func() {
+		<-w.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.running[name] == w {
+			delete(m.running, name)
+		}
+	}()
+}
@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestManager(t *testing.T) {
+	sources := map[string]chan fsnotify.Event{}
+	config := func(cycles chan<- string, name string) Config {
+		events := make(chan fsnotify.Event)
+		sources[name] = events
+		c := DefaultConfig()
+		c.Dirs = []string{t.TempDir()}
+		c.Debounce = 0
+		c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+		c.OnChange = func(context.Context, Cycle) bool {
+			cycles <- name
+			return true
+		}
+		return c
+	}
+	cycles := make(chan string)
+
+	var m Manager
+	if err := m.Start("a", config(cycles, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start("a", config(cycles, "dup")); err == nil {
+		t.Errorf("expected error starting a twice")
+	}
+	if err := m.Start("b", config(cycles, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if names := m.Names(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("unexpected names %q", names)
+	}
+
+	if !m.Stop("b") || m.Stop("b") {
+		t.Errorf("expected Stop to succeed only once")
+	}
+	sources["a"] <- fsnotify.Event{Name: "x"}
+	if name := <-cycles; name != "a" {
+		t.Errorf("expected a to trigger, got %s", name)
+	}
+
+	if err := m.Reload("a", config(cycles, "a2")); err != nil {
+		t.Fatal(err)
+	}
+	invalid := config(cycles, "a3")
+	invalid.Dirs = nil
+	if err := m.Reload("a", invalid); err == nil {
+		t.Errorf("expected invalid reload to fail")
+	}
+	sources["a2"] <- fsnotify.Event{Name: "y"}
+	if name := <-cycles; name != "a2" {
+		t.Errorf("expected a2 to trigger, got %s", name)
+	}
+
+	m.StopAll()
+	if names := m.Names(); len(names) != 0 {
+		t.Errorf("expected no names after StopAll, got %q", names)
+	}
+}
+
+func TestManagerPrunesStopped(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(context.Context, Cycle) bool { return false }
+
+	var m Manager
+	if err := m.Start("a", c); err != nil {
+		t.Fatal(err)
+	}
+	events <- fsnotify.Event{Name: "x"}
+	for i := 0; len(m.Names()) != 0; i++ {
+		if i == 100 {
+			t.Fatalf("expected a to be removed once stopped, got %q", m.Names())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := m.Start("a", c); err != nil {
+		t.Errorf("expected a to start again once stopped: %v", err)
+	}
+	m.StopAll()
+}
+
+func TestManagerReloadWhileStarting(t *testing.T) {
+	config := func(events chan fsnotify.Event) Config {
+		c := DefaultConfig()
+		c.Dirs = []string{t.TempDir()}
+		c.Debounce = 0
+		c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+		c.OnChange = func(context.Context, Cycle) bool { return true }
+		return c
+	}
+	slowEvents, ready, proceed := make(chan fsnotify.Event), make(chan struct{}), make(chan struct{})
+	slow := config(slowEvents)
+	slow.OnReady = func(Coverage) {
+		close(ready)
+		<-proceed
+	}
+
+	var m Manager
+	defer m.StopAll()
+	started := make(chan error)
+	go func() { started <- m.Start("a", slow) }()
+	<-ready
+	if err := m.Reload("a", config(make(chan fsnotify.Event))); err != nil {
+		t.Fatal(err)
+	}
+	close(proceed)
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+
+	// The watcher of the Start that lost to the Reload was halted.
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case slowEvents <- fsnotify.Event{Name: "x"}:
+		t.Errorf("expected the watcher replaced while starting to be halted")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
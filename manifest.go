@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"time"
+)
+
+// fileState is what a manifest records about each file.
+type fileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+func (a fileState) equal(b fileState) bool {
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+// snapshot records the state of every file under c.Dirs, skipping ignored
+// directories and files.
+func (c Config) snapshot() (map[string]fileState, error) {
+	files := map[string]fileState{}
+	err := c.walkFiles(func(path string, d fs.DirEntry) error {
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed during the walk
+		} else if err != nil {
+			return err
+		}
+		files[path] = fileState{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot files: %w", err)
+	}
+	return files, nil
+}
+
+// readManifest reads a manifest written by writeManifest. It returns nil and
+// no error if the file does not exist.
+func readManifest(path string) (map[string]fileState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var files map[string]fileState
+	if err = json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// writeManifest atomically replaces the manifest at path with files.
+func writeManifest(path string, files map[string]fileState) error {
+	data, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0666); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// changedOffline compares the files on disk with the manifest at c.Manifest,
+// and writes a new manifest if there was none. It returns true if OnChange
+// should be called to catch up with changes made while nobody was watching.
+func (c Config) changedOffline() (bool, error) {
+	prev, err := readManifest(c.Manifest)
+	if err != nil {
+		return true, err
+	}
+	cur, err := c.snapshot()
+	if err != nil {
+		return false, err
+	}
+	if prev == nil {
+		return false, writeManifest(c.Manifest, cur)
+	}
+	return !maps.EqualFunc(prev, cur, fileState.equal), nil
+}
@@ -0,0 +1,106 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestManifestOfflineChanges(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	rescans := make(chan Rescan, 1)
+	start := func() (chan<- struct{}, <-chan Cycle) {
+		cycles := make(chan Cycle, 1)
+		c := DefaultConfig()
+		c.Dirs = []string{dir}
+		c.Manifest = manifest
+		c.OnRescan = func(r Rescan) { rescans <- r }
+		c.OnChange = func(_ context.Context, cycle Cycle) bool {
+			cycles <- cycle
+			return true
+		}
+		halt, err := c.Watch()
+		if err != nil {
+			t.Fatalf("failed to watch: %v", err)
+		}
+		return halt, cycles
+	}
+
+	// The first run only creates the manifest.
+	halt, cycles := start()
+	select {
+	case cycle := <-cycles:
+		t.Errorf("unexpected cycle %d without a manifest", cycle.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	halt <- struct{}{}
+	if _, err := os.Stat(manifest); err != nil {
+		t.Fatalf("manifest was not created: %v", err)
+	}
+
+	// Starting again with no changes does nothing.
+	halt, cycles = start()
+	select {
+	case cycle := <-cycles:
+		t.Errorf("unexpected cycle %d without changes", cycle.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	halt <- struct{}{}
+
+	// A change made while not watching triggers right away.
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(file, []byte("ab"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	halt, cycles = start()
+	select {
+	case <-cycles:
+		<-rescans // the manifest is saved before the rescan
+	case <-time.After(time.Second):
+		t.Errorf("offline change was not detected")
+	}
+	halt <- struct{}{}
+}
+
+func TestManifestInDirs(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle)
+	dir := t.TempDir()
+
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 0
+	c.Manifest = filepath.Join(dir, "manifest.json")
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	events <- fsnotify.Event{Name: c.Manifest + ".tmp", Op: fsnotify.Create}
+	events <- fsnotify.Event{Name: c.Manifest, Op: fsnotify.Create}
+	a := filepath.Join(dir, "a")
+	if err := os.WriteFile(a, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	events <- fsnotify.Event{Name: a, Op: fsnotify.Write}
+	if cycle := <-cycles; !slices.Equal(cycle.Paths, []string{a}) {
+		t.Errorf("expected the manifest's own writes to be dropped, got %v", cycle.Paths)
+	}
+}
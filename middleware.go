@@ -0,0 +1,73 @@
+package watch
+
+import (
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Middleware processes the events of a watcher before anything else does.
+// It is given the next step and returns its own: calling next passes an
+// event on, as is or rewritten, not calling it drops the event, and calling
+// it more than once emits more events. Sampling, rewriting paths and
+// copying events elsewhere are all middlewares.
+//
+// The middlewares of Config.Middleware run in order, on a goroutine of
+// their own for each watch set, so the events they pass on are still
+// ignored, filtered and debounced as usual.
+type Middleware func(next func(fsnotify.Event)) func(fsnotify.Event)
+
+// middlewareSource is a Source whose events go through middlewares.
+type middlewareSource struct {
+	Source
+	events chan fsnotify.Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newMiddlewareSource(src Source, middlewares []Middleware) *middlewareSource {
+	s := &middlewareSource{
+		Source: src,
+		events: make(chan fsnotify.Event),
+		done:   make(chan struct{}),
+	}
+	emit := func(ev fsnotify.Event) {
+		select {
+		case s.events <- ev:
+		case <-s.done:
+		}
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		emit = middlewares[i](emit)
+	}
+	go func() {
+		// Closing events when src closes its own lets the loop restart.
+		defer close(s.events)
+		for {
+			select {
+			case ev, ok := <-src.Events():
+				if !ok {
+					return
+				}
+				emit(ev)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *middlewareSource) Events() <-chan fsnotify.Event { return s.events }
+
+func (s *middlewareSource) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.Source.Close()
+}
+
+func (s *middlewareSource) Remove(path string) error {
+	if r, ok := s.Source.(remover); ok {
+		return r.Remove(path)
+	}
+	return nil
+}
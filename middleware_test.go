@@ -0,0 +1,84 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"a.txt", "b.txt", "a.copy"} {
+		if err := os.WriteFile(path(name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle, 1)
+	var mu sync.Mutex
+	var order []string
+	log := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 20 * time.Millisecond
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.Middleware = []Middleware{
+		// Drops events for b.txt.
+		func(next func(fsnotify.Event)) func(fsnotify.Event) {
+			return func(ev fsnotify.Event) {
+				log("drop")
+				if filepath.Base(ev.Name) != "b.txt" {
+					next(ev)
+				}
+			}
+		},
+		// Copies events for .txt files to .copy files.
+		func(next func(fsnotify.Event)) func(fsnotify.Event) {
+			return func(ev fsnotify.Event) {
+				log("copy")
+				next(ev)
+				if name, ok := strings.CutSuffix(ev.Name, ".txt"); ok {
+					next(fsnotify.Event{Name: name + ".copy", Op: ev.Op})
+				}
+			}
+		},
+	}
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Halt()
+
+	events <- fsnotify.Event{Name: path("a.txt"), Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: path("b.txt"), Op: fsnotify.Write}
+	select {
+	case cycle := <-cycles:
+		if want := []string{path("a.copy"), path("a.txt")}; !slices.Equal(cycle.Paths, want) {
+			t.Errorf("expected paths %q, got %q", want, cycle.Paths)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if want := []string{"drop", "copy", "drop"}; !slices.Equal(order, want) {
+			t.Errorf("expected middlewares to run as %q, got %q", want, order)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no cycle")
+	}
+}
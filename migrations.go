@@ -0,0 +1,113 @@
+package watch
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Migration is a SQL migration file named the way migrate and goose name
+// them: a version number, an underscore and a name, optionally followed by
+// .up or .down, e.g. 000012_add_users.up.sql.
+type Migration struct {
+	// Path is the path of the file.
+	Path string
+	// Version is the number the name starts with.
+	Version uint64
+	// Name is the part of the name between the version and the extension,
+	// e.g. add_users.
+	Name string
+	// Direction is "up", "down", or empty if the name has neither.
+	Direction string
+	// Added is set if the file was created, or moved into place, during the
+	// cycle, rather than modified.
+	Added bool
+}
+
+// ParseMigration returns the Migration of the file at path, and false if its
+// name is not that of a migration.
+func ParseMigration(path string) (Migration, bool) {
+	base := filepath.Base(path)
+	if filepath.Ext(base) != ".sql" {
+		return Migration{}, false
+	}
+	base = strings.TrimSuffix(base, ".sql")
+	version, name, ok := strings.Cut(base, "_")
+	if !ok {
+		return Migration{}, false
+	}
+	n, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return Migration{}, false
+	}
+	m := Migration{Path: path, Version: n, Name: name}
+	for _, dir := range []string{"up", "down"} {
+		if strings.HasSuffix(name, "."+dir) {
+			m.Name, m.Direction = strings.TrimSuffix(name, "."+dir), dir
+		}
+	}
+	return m, true
+}
+
+// Migrations applies the migrations added or modified in each cycle. Removed
+// migrations and other files are left out. Use its OnChange as that of the
+// Config watching the migrations.
+type Migrations struct {
+	// Apply is called with the migrations of a cycle, in the order they
+	// apply: by version, with up before down. It is not called if there are
+	// none.
+	Apply func(ctx context.Context, changed []Migration) error
+	// Logger receives the failures of Apply. If nil, slog.Default() is used.
+	Logger *slog.Logger
+}
+
+// OnChange calls Apply for cycle. It always keeps the watcher running.
+func (ms Migrations) OnChange(ctx context.Context, cycle Cycle) bool {
+	var changed []Migration
+	add := func(path string, added bool) {
+		if m, ok := ParseMigration(path); ok {
+			m.Added = added
+			changed = append(changed, m)
+		}
+	}
+	for _, path := range cycle.Changes.Created {
+		add(path, true)
+	}
+	for _, r := range cycle.Changes.Renamed {
+		add(r.To, true)
+	}
+	for _, path := range cycle.Changes.Modified {
+		add(path, false)
+	}
+	if len(changed) == 0 {
+		return true
+	}
+	slices.SortFunc(changed, func(a, b Migration) int {
+		if c := cmp.Compare(a.Version, b.Version); c != 0 {
+			return c
+		}
+		if c := directionOrder(a.Direction) - directionOrder(b.Direction); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Path, b.Path)
+	})
+	if err := ms.Apply(ctx, changed); err != nil {
+		log := ms.Logger
+		if log == nil {
+			log = slog.Default()
+		}
+		log.Error("failed to apply migrations", "cycle", cycle.ID, "error", err)
+	}
+	return true
+}
+
+func directionOrder(direction string) int {
+	if direction == "down" {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package watch
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseMigration(t *testing.T) {
+	for path, want := range map[string]Migration{
+		"db/000012_add_users.up.sql":   {Version: 12, Name: "add_users", Direction: "up"},
+		"db/000012_add_users.down.sql": {Version: 12, Name: "add_users", Direction: "down"},
+		"db/20240101120000_seed.sql":   {Version: 20240101120000, Name: "seed"},
+	} {
+		want.Path = path
+		if got, ok := ParseMigration(path); !ok || got != want {
+			t.Errorf("%s: expected %+v, got %+v", path, want, got)
+		}
+	}
+	for _, path := range []string{"db/README.md", "db/add_users.sql", "db/v1_x.sql"} {
+		if _, ok := ParseMigration(path); ok {
+			t.Errorf("%s: expected not a migration", path)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	var got []Migration
+	ms := Migrations{Apply: func(_ context.Context, changed []Migration) error {
+		got = changed
+		return nil
+	}}
+	ms.OnChange(context.Background(), Cycle{Changes: ChangeSet{
+		Created:  []string{"db/2_b.down.sql", "db/2_b.up.sql", "db/notes.txt"},
+		Modified: []string{"db/1_a.up.sql"},
+		Removed:  []string{"db/3_c.up.sql"},
+	}})
+	want := []string{"db/1_a.up.sql", "db/2_b.up.sql", "db/2_b.down.sql"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, got)
+	}
+	for i, m := range got {
+		if m.Path != want[i] || m.Added != (i > 0) {
+			t.Errorf("%d: expected %s, got %+v", i, want[i], m)
+		}
+	}
+}
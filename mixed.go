@@ -0,0 +1,145 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// mixedSource is a Source that polls the directories of some roots, for
+// Config.PollDirs, and of the subtrees left out by Config.MaxDirs, for
+// Config.PollUncovered, and watches the others with another Source.
+type mixedSource struct {
+	watch, poll Source
+	roots       []string // polled
+	uncovered   []string // polled, set once walked
+	events      chan fsnotify.Event
+	errors      chan error
+	done        chan struct{}
+	once        sync.Once
+}
+
+func newMixedSource(watch, poll Source, roots []string) *mixedSource {
+	s := &mixedSource{
+		watch:  watch,
+		poll:   poll,
+		roots:  roots,
+		events: make(chan fsnotify.Event),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+	}
+	go s.forward(watch)
+	go s.forward(poll)
+	return s
+}
+
+// polled reports whether path is under one of s.roots or s.uncovered, or is
+// the directory of one of s.roots that is a file.
+func (s *mixedSource) polled(path string) bool {
+	for _, root := range s.roots {
+		if under(path, root) {
+			return true
+		}
+		if path == filepath.Dir(root) {
+			if info, err := os.Stat(root); err == nil && !info.IsDir() {
+				return true
+			}
+		}
+	}
+	for _, dir := range s.uncovered {
+		if under(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// under reports whether path is dir or is under it.
+func under(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func (s *mixedSource) Add(path string) error {
+	if s.polled(path) {
+		return s.poll.Add(path)
+	}
+	return s.watch.Add(path)
+}
+
+func (s *mixedSource) Remove(path string) error {
+	src := s.watch
+	if s.polled(path) {
+		src = s.poll
+	}
+	if r, ok := src.(remover); ok {
+		return r.Remove(path)
+	}
+	return nil
+}
+
+func (s *mixedSource) Events() <-chan fsnotify.Event { return s.events }
+func (s *mixedSource) Errors() <-chan error          { return s.errors }
+
+func (s *mixedSource) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return errors.Join(s.watch.Close(), s.poll.Close())
+}
+
+// forward sends the events and errors of src on the channels of s until s is
+// closed. If src closes its channels first, that is reported as an error and
+// the other source goes on.
+func (s *mixedSource) forward(src Source) {
+	events, errs := src.Events(), src.Errors()
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				s.send(nil, errSourceClosed)
+				continue
+			}
+			s.send(&ev, nil)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			s.send(nil, err)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *mixedSource) send(ev *fsnotify.Event, err error) {
+	if ev != nil {
+		select {
+		case s.events <- *ev:
+		case <-s.done:
+		}
+		return
+	}
+	select {
+	case s.errors <- err:
+	case <-s.done:
+	}
+}
+
+// pollUncovered adds the directories of the subtrees left out of w because of
+// c.MaxDirs to src, which routes them to the poller of mixed.
+func (c Config) pollUncovered(src Source, mixed *mixedSource, w *walked) error {
+	mixed.uncovered = w.uncovered
+	sub := c
+	sub.Dirs, sub.Globs, sub.MaxDirs = w.uncovered, nil, 0
+	walked, err := sub.walk(src.Add, nil)
+	if err != nil {
+		return fmt.Errorf("failed to poll uncovered directories: %w", err)
+	}
+	w.failed = append(w.failed, walked.failed...)
+	return nil
+}
@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPollDirs(t *testing.T) {
+	local, remote := t.TempDir(), t.TempDir()
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{local, remote}
+	c.PollDirs = []string{remote}
+	c.Poll = 10 * time.Millisecond
+	c.Debounce = 20 * time.Millisecond
+	var coverage Coverage
+	c.OnReady = func(c Coverage) { coverage = c }
+	rescans := make(chan Rescan, 10)
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	want := []RootCoverage{{Path: local, Dirs: 1, Backend: "fsnotify"}, {Path: remote, Dirs: 1, Backend: "poll"}}
+	if !slices.Equal(coverage.Roots, want) {
+		t.Errorf("expected %v, got %v", want, coverage.Roots)
+	}
+
+	for _, dir := range []string{local, remote} {
+		path := filepath.Join(dir, "f")
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case cycle := <-cycles:
+			if !slices.Contains(cycle.Paths, path) {
+				t.Errorf("expected %s, got %v", path, cycle.Paths)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not seen", path)
+		}
+		<-rescans
+	}
+}
+
+func TestNinePMount(t *testing.T) {
+	if onNinePMount(t.TempDir()) {
+		t.Skip("the temporary directory is on a 9p mount")
+	}
+	if onNinePMount(filepath.Join(t.TempDir(), "missing")) {
+		t.Errorf("a missing path is not on a 9p mount")
+	}
+}
+
+func TestPollUncovered(t *testing.T) {
+	if !fsnotifySupported {
+		t.Skip("fsnotify is not supported")
+	}
+	dir := t.TempDir()
+	for _, sub := range []string{"a", "b", filepath.Join("b", "c")} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.MaxDirs = 2
+	c.PollUncovered = true
+	c.Poll = 10 * time.Millisecond
+	c.Debounce = 20 * time.Millisecond
+	var coverage Coverage
+	c.OnReady = func(c Coverage) { coverage = c }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	if want := []string{filepath.Join(dir, "b")}; !slices.Equal(coverage.Uncovered, want) {
+		t.Errorf("expected %v uncovered, got %v", want, coverage.Uncovered)
+	}
+	path := filepath.Join(dir, "b", "c", "f")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		if !slices.Contains(cycle.Paths, path) {
+			t.Errorf("expected %s, got %v", path, cycle.Paths)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s was not seen", path)
+	}
+}
+
+func TestMixedSourcePolled(t *testing.T) {
+	dir := t.TempDir()
+	sub, file := filepath.Join(dir, "sub"), filepath.Join(dir, "file")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &mixedSource{roots: []string{sub}}
+	if !s.polled(sub) || !s.polled(filepath.Join(sub, "a")) {
+		t.Errorf("expected %s and its subdirectories to be polled", sub)
+	}
+	if s.polled(dir) {
+		t.Errorf("expected the parent of a polled directory to be watched")
+	}
+	s.roots = []string{file}
+	if !s.polled(dir) {
+		t.Errorf("expected the directory of a polled file to be polled")
+	}
+}
@@ -0,0 +1,17 @@
+package watch
+
+import "syscall"
+
+// v9fsMagic is the file system type of 9p mounts, e.g. the Windows drives
+// under /mnt in WSL2.
+const v9fsMagic = 0x01021997
+
+// onNinePMount reports whether path is on a 9p mount, where changes made from
+// the other side of the mount do not cause inotify events.
+func onNinePMount(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return int64(st.Type) == v9fsMagic
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package watch
+
+// onNinePMount reports false: 9p mounts are only detected on Linux.
+func onNinePMount(path string) bool { return false }
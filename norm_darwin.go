@@ -0,0 +1,8 @@
+package watch
+
+import "golang.org/x/text/unicode/norm"
+
+// normPath returns path in Unicode normalization form C. macOS file systems
+// may return names decomposed (NFD) regardless of how they were created, so
+// event paths and patterns are composed before they are matched or compared.
+func normPath(path string) string { return norm.NFC.String(path) }
@@ -0,0 +1,30 @@
+package watch
+
+import "testing"
+
+func TestNormPath(t *testing.T) {
+	nfc, nfd := "caf\u00e9.txt", "cafe\u0301.txt"
+	if normPath(nfd) != nfc {
+		t.Errorf("expected %q to be composed", nfd)
+	}
+	c := Config{Ignore: []string{nfc}}
+	if c.ignoredBy(normPath(nfd)) == "" {
+		t.Errorf("expected a composed pattern to match a decomposed name")
+	}
+	if !Glob(nfd).Match(nfc) {
+		t.Errorf("expected a decomposed Glob to match a composed name")
+	}
+}
+
+func TestNormPathWalked(t *testing.T) {
+	nfc, nfd := "caf\u00e9", "cafe\u0301"
+	s := newPathSet(false)
+	s.add("/tmp/" + nfd)
+	if !s.has("/tmp/" + nfc) {
+		t.Errorf("expected a decomposed directory to be found by its composed path")
+	}
+	w := walked{files: map[string]bool{normPath("/tmp/" + nfd + ".txt"): true}, fileDirs: map[string]bool{"/tmp": true}}
+	if !w.keep("/tmp/" + nfc + ".txt") {
+		t.Errorf("expected the event of a decomposed root file to be kept")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package watch
+
+// normPath returns path as is: only macOS file systems decompose names.
+func normPath(path string) string { return path }
@@ -0,0 +1,134 @@
+// Package notify sends a summary of the cycles of a watcher to Slack, Discord
+// or by email. It is a package of its own so that the watch package doesn't
+// import net/http and net/smtp.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+
+	"github.com/infogulch/watch"
+)
+
+// Notifier sends a message, e.g. to a chat channel, for OnChange.
+type Notifier interface {
+	Notify(ctx context.Context, msg string) error
+}
+
+// Slack is the URL of a Slack incoming webhook.
+type Slack string
+
+// Notify posts msg to the webhook.
+func (u Slack) Notify(ctx context.Context, msg string) error {
+	return postJSON(ctx, string(u), map[string]string{"text": msg})
+}
+
+// Discord is the URL of a Discord webhook.
+type Discord string
+
+// Notify posts msg to the webhook.
+func (u Discord) Notify(ctx context.Context, msg string) error {
+	return postJSON(ctx, string(u), map[string]string{"content": msg})
+}
+
+func postJSON(ctx context.Context, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post notification: %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTP sends notifications by email.
+type SMTP struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// Auth, if not nil, authenticates with the server.
+	Auth smtp.Auth
+	// From is the sender's address.
+	From string
+	// To are the recipients' addresses.
+	To []string
+	// Subject is the subject of the emails; if empty, the first line of the
+	// message is used.
+	Subject string
+}
+
+// Notify emails msg to n.To. The email is not sent with ctx, as net/smtp
+// does not take one.
+func (n SMTP) Notify(ctx context.Context, msg string) error {
+	subject := n.Subject
+	if subject == "" {
+		subject, _, _ = strings.Cut(msg, "\n")
+	}
+	mail := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		n.From, strings.Join(n.To, ", "), subject, strings.ReplaceAll(msg, "\n", "\r\n"))
+	if err := smtp.SendMail(n.Addr, n.Auth, n.From, n.To, []byte(mail)); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// notifyPaths is the most paths listed in a notification.
+const notifyPaths = 10
+
+// OnChange returns a watch.Config.OnChange that calls onchange, if not nil,
+// and sends a summary of the cycle through n: the host, what changed, and the
+// error of onchange, if any. With onlyFailures, it is only sent when
+// onchange fails. Failures to notify are logged to slog.Default(). The
+// watcher is kept running either way.
+func OnChange(n Notifier, onlyFailures bool, onchange func(ctx context.Context, cycle watch.Cycle) error) func(ctx context.Context, cycle watch.Cycle) bool {
+	return func(ctx context.Context, cycle watch.Cycle) bool {
+		var err error
+		if onchange != nil {
+			err = onchange(ctx, cycle)
+		}
+		if err == nil && onlyFailures {
+			return true
+		}
+		if nerr := n.Notify(ctx, summary(cycle, err)); nerr != nil {
+			slog.Default().Error("failed to notify", "cycle", cycle.ID, "error", nerr)
+		}
+		return true
+	}
+}
+
+// summary describes cycle and the error of its OnChange for a notification.
+func summary(cycle watch.Cycle, err error) string {
+	host, _ := os.Hostname()
+	ch := cycle.Changes
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: cycle %d: %d created, %d modified, %d removed, %d renamed",
+		host, cycle.ID, len(ch.Created), len(ch.Modified), len(ch.Removed), len(ch.Renamed))
+	if err != nil {
+		fmt.Fprintf(&b, "\nfailed: %v", err)
+	}
+	for i, path := range cycle.Paths {
+		if i == notifyPaths {
+			fmt.Fprintf(&b, "\n(%d more)", len(cycle.Paths)-i)
+			break
+		}
+		b.WriteString("\n" + path)
+	}
+	return b.String()
+}
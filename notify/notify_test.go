@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/infogulch/watch"
+)
+
+type notifications []string
+
+func (n *notifications) Notify(_ context.Context, msg string) error {
+	*n = append(*n, msg)
+	return nil
+}
+
+func TestOnChange(t *testing.T) {
+	var sent notifications
+	cycle := watch.Cycle{ID: 7, Paths: []string{"a", "b"}, Changes: watch.ChangeSet{Created: []string{"a"}, Modified: []string{"b"}}}
+	OnChange(&sent, false, nil)(context.Background(), cycle)
+	if len(sent) != 1 || !strings.Contains(sent[0], "cycle 7: 1 created, 1 modified, 0 removed, 0 renamed\na\nb") {
+		t.Errorf("unexpected notifications %q", sent)
+	}
+
+	sent = nil
+	ok := func(context.Context, watch.Cycle) error { return nil }
+	OnChange(&sent, true, ok)(context.Background(), cycle)
+	if len(sent) != 0 {
+		t.Errorf("expected no notification without a failure, got %q", sent)
+	}
+	fail := func(context.Context, watch.Cycle) error { return errors.New("boom") }
+	OnChange(&sent, true, fail)(context.Background(), cycle)
+	if len(sent) != 1 || !strings.Contains(sent[0], "failed: boom") {
+		t.Errorf("expected a failure notification, got %q", sent)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	for n, key := range map[Notifier]string{Slack(srv.URL): "text", Discord(srv.URL): "content"} {
+		got = nil
+		if err := n.Notify(context.Background(), "hi"); err != nil {
+			t.Fatal(err)
+		}
+		if got[key] != "hi" {
+			t.Errorf("%T: expected %s to be hi, got %v", n, key, got)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package watch
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathSet is a set of cleaned paths that stores each path as the index of
+// its parent and its base name, so that the directories of a large tree
+// share their prefixes instead of each holding a full copy. Looking up a
+// path costs one map access per path element. Paths are kept with normPath,
+// like the paths of events.
+type pathSet struct {
+	slash bool              // paths of an fs.FS rather than of the OS
+	index map[pathKey]int32 // -> position in nodes
+	nodes []pathNode
+	count int
+}
+
+type pathKey struct {
+	parent int32 // -1 for a root such as "/", "C:\" or "."
+	name   string
+}
+
+type pathNode struct {
+	pathKey
+	member bool // false for the ancestors of members that are not in the set
+}
+
+func newPathSet(slash bool) *pathSet {
+	return &pathSet{slash: slash, index: map[pathKey]int32{}}
+}
+
+func (s *pathSet) split(p string) (dir, name string) {
+	if s.slash {
+		return path.Dir(p), path.Base(p)
+	}
+	return filepath.Dir(p), filepath.Base(p)
+}
+
+// key returns the node of p, adding nodes for it and its ancestors if
+// create is true. It returns false if p has no node.
+func (s *pathSet) key(p string, create bool) (int32, bool) {
+	var k pathKey
+	if dir, name := s.split(p); dir == p {
+		k = pathKey{parent: -1, name: p}
+	} else {
+		parent, ok := s.key(dir, create)
+		if !ok {
+			return 0, false
+		}
+		k = pathKey{parent: parent, name: name}
+	}
+	if i, ok := s.index[k]; ok || !create {
+		return i, ok
+	}
+	// The name is usually a slice of a longer path, which it would keep
+	// alive.
+	k.name = strings.Clone(k.name)
+	i := int32(len(s.nodes))
+	s.nodes = append(s.nodes, pathNode{pathKey: k})
+	s.index[k] = i
+	return i, true
+}
+
+// add adds p, and reports whether it was not in s already.
+func (s *pathSet) add(p string) bool {
+	i, _ := s.key(normPath(p), true)
+	if s.nodes[i].member {
+		return false
+	}
+	s.nodes[i].member = true
+	s.count += 1
+	return true
+}
+
+func (s *pathSet) has(p string) bool {
+	i, ok := s.key(normPath(p), false)
+	return ok && s.nodes[i].member
+}
+
+func (s *pathSet) len() int { return s.count }
+
+// removeUnder removes p and every path under it, and returns them.
+func (s *pathSet) removeUnder(p string) []string {
+	top, ok := s.key(normPath(p), false)
+	if !ok {
+		return nil
+	}
+	var removed []string
+	for i := range s.nodes {
+		if !s.nodes[i].member || !s.under(int32(i), top) {
+			continue
+		}
+		s.nodes[i].member = false
+		s.count -= 1
+		removed = append(removed, s.path(int32(i)))
+	}
+	return removed
+}
+
+// under reports whether node i is node top or one of its descendants.
+func (s *pathSet) under(i, top int32) bool {
+	for ; i >= 0; i = s.nodes[i].parent {
+		if i == top {
+			return true
+		}
+	}
+	return false
+}
+
+// path rebuilds the path of node i.
+func (s *pathSet) path(i int32) string {
+	n := s.nodes[i]
+	if n.parent < 0 {
+		return n.name
+	}
+	if s.slash {
+		return path.Join(s.path(n.parent), n.name)
+	}
+	return filepath.Join(s.path(n.parent), n.name)
+}
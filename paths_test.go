@@ -0,0 +1,46 @@
+package watch
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPathSet(t *testing.T) {
+	root := t.TempDir()
+	path := func(elems ...string) string { return filepath.Join(append([]string{root}, elems...)...) }
+
+	s := newPathSet(false)
+	for _, p := range []string{path(), path("a"), path("a", "b"), path("a", "b", "c"), path("ab"), "rel", filepath.Join("rel", "x")} {
+		if !s.add(p) {
+			t.Errorf("%s was added already", p)
+		}
+	}
+	if s.add(path("a")) {
+		t.Errorf("adding %s twice reported it new", path("a"))
+	}
+	if s.len() != 7 {
+		t.Errorf("expected 7 paths, got %d", s.len())
+	}
+	if !s.has(path("a", "b")) || !s.has("rel") || s.has(path("a", "x")) || s.has(filepath.Dir(root)) {
+		t.Errorf("unexpected membership")
+	}
+
+	removed := s.removeUnder(path("a"))
+	slices.Sort(removed)
+	if want := []string{path("a"), path("a", "b"), path("a", "b", "c")}; !slices.Equal(removed, want) {
+		t.Errorf("expected to remove %q, got %q", want, removed)
+	}
+	if s.len() != 4 || s.has(path("a", "b")) || !s.has(path("ab")) || !s.has(path()) {
+		t.Errorf("unexpected membership after removal")
+	}
+	if !s.add(path("a", "b")) || s.has(path("a")) {
+		t.Errorf("unexpected membership after adding again")
+	}
+
+	fsys := newPathSet(true)
+	fsys.add("src/sub")
+	if removed := fsys.removeUnder("src"); !slices.Equal(removed, []string{"src/sub"}) {
+		t.Errorf("expected to remove src/sub, got %q", removed)
+	}
+}
@@ -0,0 +1,120 @@
+// Package plugin loads new builds of Go plugins as they appear in a watched
+// directory. It is a package of its own because importing the standard
+// plugin package links a program dynamically, with cgo.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sync"
+
+	"github.com/infogulch/watch"
+)
+
+// Loader loads every new build of the Go plugins in a watched directory. Use
+// its OnChange as that of a watch.Config watching the directory the plugins
+// are built into, and get the latest one with Plugin.
+//
+// Go caches plugins by path and can't unload them, so each build is opened
+// from a copy of its own, and the plugins loaded before stay in memory.
+// Builds of the same package must have different plugin paths too, e.g.
+// with go build -buildmode=plugin -ldflags=-pluginpath=name-$(date +%s),
+// or opening them fails with "plugin already loaded".
+type Loader struct {
+	// Load, if not nil, is called with each plugin opened, e.g. to look up
+	// and check its symbols. If it fails, the previous build is kept.
+	Load func(path string, p *plugin.Plugin) error
+
+	// Logger receives load failures. If nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	plugins map[string]*plugin.Plugin
+}
+
+// OnChange loads the .so files changed in cycle. It always keeps the watcher
+// running.
+func (l *Loader) OnChange(ctx context.Context, cycle watch.Cycle) bool {
+	log := l.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	for _, path := range append(cycle.Changes.Created, cycle.Changes.Modified...) {
+		if filepath.Ext(path) != ".so" {
+			continue
+		}
+		if err := l.load(path); err != nil {
+			log.Error("failed to load plugin", "cycle", cycle.ID, "path", path, "error", err)
+		}
+	}
+	for _, r := range cycle.Changes.Renamed {
+		if filepath.Ext(r.To) != ".so" {
+			continue
+		}
+		if err := l.load(r.To); err != nil {
+			log.Error("failed to load plugin", "cycle", cycle.ID, "path", r.To, "error", err)
+		}
+	}
+	return true
+}
+
+// Plugin returns the latest build of the plugin at path that was loaded, or
+// nil if there is none.
+func (l *Loader) Plugin(path string) *plugin.Plugin {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.plugins[path]
+}
+
+// load opens a copy of the plugin at path, and swaps it in once Load accepts
+// it.
+func (l *Loader) load(path string) error {
+	copied, err := copyPlugin(path)
+	if err != nil {
+		return err
+	}
+	p, err := plugin.Open(copied)
+	os.Remove(copied) // mapped once opened
+	if err != nil {
+		return err
+	}
+	if l.Load != nil {
+		if err := l.Load(path, p); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.plugins == nil {
+		l.plugins = map[string]*plugin.Plugin{}
+	}
+	l.plugins[path] = p
+	return nil
+}
+
+// copyPlugin copies the plugin at path to a new temporary file.
+func copyPlugin(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open plugin: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "watch-plugin-*.so")
+	if err != nil {
+		return "", fmt.Errorf("failed to copy plugin: %w", err)
+	}
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("failed to copy plugin: %w", err)
+	}
+	return dst.Name(), nil
+}
@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"plugin"
+	"testing"
+
+	"github.com/infogulch/watch"
+)
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broken.so")
+	if err := os.WriteFile(path, []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := 0
+	l := &Loader{Load: func(string, *plugin.Plugin) error {
+		loaded++
+		return nil
+	}}
+	l.OnChange(context.Background(), watch.Cycle{Changes: watch.ChangeSet{
+		Created:  []string{path},
+		Modified: []string{filepath.Join(dir, "notes.txt")},
+	}})
+	if loaded != 0 || l.Plugin(path) != nil {
+		t.Errorf("a file that is not a plugin was loaded")
+	}
+}
@@ -0,0 +1,268 @@
+package watch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultPoll is the polling interval used with Config.FS when Config.Poll is
+// not set.
+const DefaultPoll = time.Second
+
+// PollWatcher is a Source that finds changes by listing every directory added
+// to it at a fixed interval and comparing the entries' size, modification
+// time and mode with the previous listing. It works where fsnotify gets no
+// events, and on any fs.FS. On the OS filesystem, an entry that disappears in
+// a round while the same file appears elsewhere is reported as a rename
+// immediately followed by a create, as fsnotify reports moves.
+//
+// It is what Config.Poll uses, and can be used on its own like an
+// fsnotify.Watcher, e.g. in tests or on filesystems fsnotify doesn't
+// support. Like one, it watches the entries of the directories added, not
+// their subdirectories.
+type PollWatcher struct {
+	fsys     fs.FS // nil for the OS filesystem
+	interval time.Duration
+	events   chan fsnotify.Event
+	errors   chan error
+	done     chan struct{}
+	once     sync.Once
+
+	mu   sync.Mutex
+	dirs map[string]map[string]entryState // dir -> entry name -> state
+}
+
+type entryState struct {
+	size  int64
+	mtime time.Time
+	mode  fs.FileMode
+	id    fileID // to find moves; zero with an fs.FS
+}
+
+// NewPollWatcher starts a PollWatcher that lists its directories every
+// interval, or every DefaultPoll if interval is not greater than zero. fsys
+// is the filesystem of the directories, or nil for the OS filesystem. Close
+// stops it.
+func NewPollWatcher(fsys fs.FS, interval time.Duration) *PollWatcher {
+	if interval <= 0 {
+		interval = DefaultPoll
+	}
+	s := &PollWatcher{
+		fsys:     fsys,
+		interval: interval,
+		events:   make(chan fsnotify.Event),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+		dirs:     map[string]map[string]entryState{},
+	}
+	go s.run()
+	return s
+}
+
+// Add starts watching the entries of dir, as of now.
+func (s *PollWatcher) Add(dir string) error {
+	entries, err := s.list(dir)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dirs[dir] = entries
+	s.mu.Unlock()
+	return nil
+}
+
+// Remove stops watching dir.
+func (s *PollWatcher) Remove(dir string) error {
+	s.mu.Lock()
+	delete(s.dirs, dir)
+	s.mu.Unlock()
+	return nil
+}
+
+// Events returns the channel events are delivered on.
+func (s *PollWatcher) Events() <-chan fsnotify.Event { return s.events }
+
+// Errors returns the channel errors are delivered on.
+func (s *PollWatcher) Errors() <-chan error { return s.errors }
+
+// Close stops polling. Events found in a round in progress are dropped, and
+// the channels of s are left open.
+func (s *PollWatcher) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *PollWatcher) list(dir string) (map[string]entryState, error) {
+	var entries []fs.DirEntry
+	var err error
+	if s.fsys != nil {
+		entries, err = fs.ReadDir(s.fsys, dir)
+	} else {
+		entries, err = os.ReadDir(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]entryState, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // removed since the directory was read
+		} else if err != nil {
+			return nil, err
+		}
+		state := entryState{size: info.Size(), mtime: info.ModTime(), mode: info.Mode()}
+		if s.fsys == nil {
+			state.id = fileIDOf(info)
+		}
+		states[e.Name()] = state
+	}
+	return states, nil
+}
+
+func (s *PollWatcher) join(dir, name string) string {
+	if s.fsys != nil {
+		return path.Join(dir, name)
+	}
+	return filepath.Join(dir, name)
+}
+
+func (s *PollWatcher) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		if !s.poll() {
+			return
+		}
+	}
+}
+
+// poll lists every directory once and sends the differences as events. It
+// returns false if the source was closed.
+func (s *PollWatcher) poll() bool {
+	s.mu.Lock()
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	s.mu.Unlock()
+	slices.Sort(dirs)
+
+	var events []pollEvent
+	for _, dir := range dirs {
+		s.mu.Lock()
+		prev := s.dirs[dir]
+		s.mu.Unlock()
+
+		cur, err := s.list(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			s.mu.Lock()
+			delete(s.dirs, dir)
+			s.mu.Unlock()
+			events = append(events, pollEvent{Event: fsnotify.Event{Name: dir, Op: fsnotify.Remove}})
+			continue
+		} else if err != nil {
+			select {
+			case s.errors <- err:
+				continue
+			case <-s.done:
+				return false
+			}
+		}
+		s.mu.Lock()
+		s.dirs[dir] = cur
+		s.mu.Unlock()
+
+		names := make([]string, 0, len(cur)+len(prev))
+		for name := range cur {
+			names = append(names, name)
+		}
+		for name := range prev {
+			if _, ok := cur[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			before, existed := prev[name]
+			after, exists := cur[name]
+			ev := pollEvent{Event: fsnotify.Event{Name: s.join(dir, name)}}
+			switch {
+			case !existed:
+				ev.Op, ev.id = fsnotify.Create, after.id
+			case !exists:
+				ev.Op, ev.id = fsnotify.Remove, before.id
+			case before.size != after.size || !before.mtime.Equal(after.mtime):
+				ev.Op = fsnotify.Write
+			case before.mode != after.mode:
+				ev.Op = fsnotify.Chmod
+			default:
+				continue
+			}
+			events = append(events, ev)
+		}
+	}
+
+	for _, ev := range pairMoves(events) {
+		if !s.send(ev) {
+			return false
+		}
+	}
+	return true
+}
+
+// pollEvent is an event found by polling, with the file it is about if that
+// was created or removed.
+type pollEvent struct {
+	fsnotify.Event
+	id fileID
+}
+
+// pairMoves turns each removal of a file that was also created elsewhere into
+// a rename, immediately followed by the create.
+func pairMoves(events []pollEvent) []fsnotify.Event {
+	to := make(map[int]int) // index of removal -> index of create
+	paired := make([]bool, len(events))
+	for i, ev := range events {
+		if ev.Op != fsnotify.Remove {
+			continue
+		}
+		for j, c := range events {
+			if !paired[j] && c.Op == fsnotify.Create && sameFile(ev.id, c.id) {
+				to[i], paired[j] = j, true
+				break
+			}
+		}
+	}
+	out := make([]fsnotify.Event, 0, len(events))
+	for i, ev := range events {
+		if j, ok := to[i]; ok {
+			out = append(out, fsnotify.Event{Name: ev.Name, Op: fsnotify.Rename}, events[j].Event)
+		} else if !paired[i] {
+			out = append(out, ev.Event)
+		}
+	}
+	return out
+}
+
+func (s *PollWatcher) send(ev fsnotify.Event) bool {
+	select {
+	case s.events <- ev:
+		return true
+	case <-s.done:
+		return false
+	}
+}
@@ -0,0 +1,193 @@
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// lockedFS guards a MapFS so the test can change it while it is polled.
+type lockedFS struct {
+	mu sync.Mutex
+	m  fstest.MapFS
+}
+
+func (l *lockedFS) Open(name string) (fs.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.m.Open(name)
+}
+
+func (l *lockedFS) set(name string, f *fstest.MapFile) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f == nil {
+		delete(l.m, name)
+	} else {
+		l.m[name] = f
+	}
+}
+
+func TestPollFS(t *testing.T) {
+	fsys := &lockedFS{m: fstest.MapFS{
+		"src/a.txt":       {Data: []byte("a")},
+		"src/sub/b.txt":   {Data: []byte("b")},
+		"src/.git/HEAD":   {Data: []byte("ref")},
+		"other/elsewhere": {Data: []byte("x")},
+	}}
+
+	cycles := make(chan Cycle)
+	c := DefaultConfig()
+	c.FS = fsys
+	c.Dirs = []string{"src"}
+	c.Poll = 10 * time.Millisecond
+	c.Debounce = 20 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	rescans := make(chan Rescan, 1)
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	expect := func(want ...string) {
+		t.Helper()
+		select {
+		case cycle := <-cycles:
+			if !slices.Equal(cycle.Paths, want) {
+				t.Errorf("got paths %q, want %q", cycle.Paths, want)
+			}
+			<-rescans
+		case <-time.After(time.Second):
+			t.Fatalf("no change detected, want %q", want)
+		}
+	}
+
+	fsys.set("src/a.txt", &fstest.MapFile{Data: []byte("aa")})
+	fsys.set("src/sub/c.txt", &fstest.MapFile{Data: []byte("c")})
+	expect("src/a.txt", "src/sub/c.txt")
+
+	fsys.set("src/sub/b.txt", nil)
+	fsys.set("src/.git/HEAD", &fstest.MapFile{Data: []byte("ref2")})
+	fsys.set("other/elsewhere", &fstest.MapFile{Data: []byte("y")})
+	expect("src/sub/b.txt")
+
+	fsys.set("src/a.txt", &fstest.MapFile{Data: []byte("aa"), Mode: 0600})
+	expect("src/a.txt")
+}
+
+func TestPollOS(t *testing.T) {
+	dir := t.TempDir()
+	cycles := make(chan Cycle)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Poll = 10 * time.Millisecond
+	c.Debounce = 20 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		if !slices.Equal(cycle.Paths, []string{file}) {
+			t.Errorf("got paths %q", cycle.Paths)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no change detected")
+	}
+}
+
+func TestPollRename(t *testing.T) {
+	dir := t.TempDir()
+	old, moved := filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")
+	if err := os.WriteFile(old, []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Dir(moved), 0777); err != nil {
+		t.Fatal(err)
+	}
+	cycles := make(chan Cycle)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Poll = 10 * time.Millisecond
+	c.Debounce = 20 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	if err := os.Rename(old, moved); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		want := []Rename{{From: old, To: moved}}
+		if !slices.Equal(cycle.Changes.Renamed, want) || len(cycle.Changes.Created) != 0 || len(cycle.Changes.Removed) != 0 {
+			t.Errorf("got changes %+v, want renames %+v", cycle.Changes, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no change detected")
+	}
+}
+
+func TestPollWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w := NewPollWatcher(nil, 10*time.Millisecond)
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-w.Events():
+		if ev.Name != path || !ev.Has(fsnotify.Create) {
+			t.Errorf("got %v, want a create of %s", ev, path)
+		}
+	case err := <-w.Errors():
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+
+	if err := w.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-w.Events():
+		t.Errorf("got %v after the directory was removed", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,133 @@
+package watch
+
+import (
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// filterPool matches events against a Filter on a fixed number of
+// goroutines, and delivers the results in the order the events were
+// submitted. Submitting never blocks, so the loop keeps draining its source
+// while slow filters run.
+type filterPool struct {
+	filter  Filter
+	jobs    chan *filterJob // to the workers
+	ordered chan *filterJob // to deliver, in order
+	results chan filterResult
+	done    chan struct{}
+	once    sync.Once
+
+	mu     sync.Mutex
+	queue  []*filterJob // submitted, not yet given to a worker
+	notify chan struct{}
+}
+
+type filterJob struct {
+	ev    fsnotify.Event
+	match chan bool
+}
+
+// filterResult is an event submitted to a filterPool, and whether it
+// matched.
+type filterResult struct {
+	ev    fsnotify.Event
+	match bool
+}
+
+func newFilterPool(filter Filter, workers int) *filterPool {
+	p := &filterPool{
+		filter:  filter,
+		jobs:    make(chan *filterJob),
+		ordered: make(chan *filterJob, workers),
+		results: make(chan filterResult),
+		done:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	go p.dispatch()
+	go p.deliver()
+	return p
+}
+
+// submit queues ev to be matched.
+func (p *filterPool) submit(ev fsnotify.Event) {
+	p.mu.Lock()
+	p.queue = append(p.queue, &filterJob{ev: ev, match: make(chan bool, 1)})
+	p.mu.Unlock()
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *filterPool) Close() {
+	p.once.Do(func() { close(p.done) })
+}
+
+// dispatch hands the queue to the workers in order, and to deliver in the
+// same order, until p is closed.
+func (p *filterPool) dispatch() {
+	for {
+		p.mu.Lock()
+		queue := p.queue
+		p.queue = nil
+		p.mu.Unlock()
+		if len(queue) == 0 {
+			select {
+			case <-p.notify:
+				continue
+			case <-p.done:
+				return
+			}
+		}
+		for _, job := range queue {
+			select {
+			case p.ordered <- job:
+			case <-p.done:
+				return
+			}
+			select {
+			case p.jobs <- job:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+func (p *filterPool) work() {
+	for {
+		select {
+		case job := <-p.jobs:
+			job.match <- p.filter.Match(job.ev.Name)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// deliver sends the result of each job once it is matched, in order.
+func (p *filterPool) deliver() {
+	for {
+		var job *filterJob
+		select {
+		case job = <-p.ordered:
+		case <-p.done:
+			return
+		}
+		var match bool
+		select {
+		case match = <-job.match:
+		case <-p.done:
+			return
+		}
+		select {
+		case p.results <- filterResult{job.ev, match}:
+		case <-p.done:
+			return
+		}
+	}
+}
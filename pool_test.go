@@ -0,0 +1,87 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// slowFilter matches .go files, taking longer for paths that sort first.
+type slowFilter struct{}
+
+func (slowFilter) Match(path string) bool {
+	if strings.HasSuffix(path, "a.go") {
+		time.Sleep(50 * time.Millisecond)
+	} else {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return filepath.Ext(path) == ".go"
+}
+
+func (slowFilter) String() string { return "slowFilter()" }
+
+func TestFilterWorkers(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, name := range []string{"b.go", "c.go", "d.go", "e.txt"} {
+		if err := os.WriteFile(path(name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 20 * time.Millisecond
+	c.Filter = slowFilter{}
+	c.FilterWorkers = 4
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Halt()
+
+	// The slow match of the rename must not separate it from its create,
+	// nor delay the events after it.
+	start := time.Now()
+	for _, ev := range []fsnotify.Event{
+		{Name: path("a.go"), Op: fsnotify.Rename},
+		{Name: path("b.go"), Op: fsnotify.Create},
+		{Name: path("c.go"), Op: fsnotify.Write},
+		{Name: path("d.go"), Op: fsnotify.Write},
+		{Name: path("e.txt"), Op: fsnotify.Write},
+	} {
+		events <- ev
+	}
+	if d := time.Since(start); d > 40*time.Millisecond {
+		t.Errorf("sending the events took %v", d)
+	}
+	select {
+	case cycle := <-cycles:
+		if want := []string{path("a.go"), path("b.go"), path("c.go"), path("d.go")}; !slices.Equal(cycle.Paths, want) {
+			t.Errorf("expected paths %q, got %q", want, cycle.Paths)
+		}
+		if want := []Rename{{From: path("a.go"), To: path("b.go")}}; !slices.Equal(cycle.Changes.Renamed, want) {
+			t.Errorf("expected renames %v, got %v", want, cycle.Changes.Renamed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no cycle")
+	}
+	select {
+	case cycle := <-cycles:
+		t.Errorf("unexpected cycle %+v", cycle)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
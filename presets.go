@@ -0,0 +1,140 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Preset is a ready-made setup for a common development pipeline. Get one
+// with LookupPreset, adjust it if needed, and Apply it to a Config.
+type Preset struct {
+	// Name is the name the preset is looked up by.
+	Name string
+	// Debounce replaces Config.Debounce, long enough for the steps'
+	// generators to finish writing before the next cycle.
+	Debounce time.Duration
+	// Ignore is added to Config.Ignore. It has the outputs of the steps, so
+	// that running them doesn't start another cycle.
+	Ignore []string
+	// Filter is the sources of the steps.
+	Filter Filter
+	// Steps are run in order for each cycle.
+	Steps []Step
+	// Logger receives the failures of the steps. If nil, slog.Default() is
+	// used.
+	Logger *slog.Logger
+}
+
+// Step is a command run by a Preset.
+type Step struct {
+	// Name identifies the step in logs.
+	Name string
+	// Command is the program and its arguments, run in the directory given
+	// to Preset.OnChange.
+	Command []string
+	// Filter, if not nil, selects the changes the step runs for. It also
+	// runs after any earlier step did, as that may have changed its inputs.
+	Filter Filter
+}
+
+var presets = []Preset{
+	{
+		Name:     "go",
+		Debounce: 100 * time.Millisecond,
+		Filter:   Ext(".go", ".mod", ".sum"),
+		Steps: []Step{
+			{Name: "build", Command: []string{"go", "build", "./..."}, Filter: Ext(".go", ".mod", ".sum")},
+		},
+	},
+	{
+		Name:     "templ",
+		Debounce: 200 * time.Millisecond,
+		Ignore:   []string{"*_templ.go", "*_templ.txt"},
+		Filter:   Ext(".templ", ".go", ".mod", ".sum"),
+		Steps: []Step{
+			{Name: "templ", Command: []string{"templ", "generate"}, Filter: Ext(".templ")},
+			{Name: "build", Command: []string{"go", "build", "./..."}, Filter: Ext(".go", ".mod", ".sum")},
+		},
+	},
+	{
+		Name:     "web",
+		Debounce: 200 * time.Millisecond,
+		Ignore:   []string{"*_templ.go", "*_templ.txt", "static"},
+		Filter:   Ext(".templ", ".go", ".mod", ".sum", ".css", ".js", ".ts", ".jsx", ".tsx"),
+		Steps: []Step{
+			{Name: "templ", Command: []string{"templ", "generate"}, Filter: Ext(".templ")},
+			{Name: "tailwind", Command: []string{"tailwindcss", "-i", "styles/input.css", "-o", "static/styles.css"}, Filter: Ext(".templ", ".css", ".html", ".js", ".ts", ".jsx", ".tsx")},
+			{Name: "esbuild", Command: []string{"esbuild", "js/main.js", "--bundle", "--outdir=static"}, Filter: Ext(".js", ".ts", ".jsx", ".tsx")},
+			{Name: "build", Command: []string{"go", "build", "./..."}, Filter: Ext(".go", ".mod", ".sum")},
+		},
+	},
+}
+
+// Presets returns the names of the presets, e.g. "go", "templ" and "web"
+// (templ, tailwindcss and esbuild, with their output in static).
+func Presets() []string {
+	names := make([]string, len(presets))
+	for i, p := range presets {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// LookupPreset returns the preset called name.
+func LookupPreset(name string) (Preset, error) {
+	i := slices.IndexFunc(presets, func(p Preset) bool { return p.Name == name })
+	if i < 0 {
+		return Preset{}, fmt.Errorf("unknown preset %q, expected one of %s", name, strings.Join(Presets(), ", "))
+	}
+	p := presets[i]
+	p.Ignore = slices.Clone(p.Ignore)
+	p.Steps = slices.Clone(p.Steps)
+	return p, nil
+}
+
+// Apply returns c with the Debounce, Ignore and Filter of p. A Filter of c
+// is combined with that of p.
+func (p Preset) Apply(c Config) Config {
+	c.Debounce = p.Debounce
+	c.Ignore = append(c.Ignore[:len(c.Ignore):len(c.Ignore)], p.Ignore...)
+	if c.Filter != nil && p.Filter != nil {
+		c.Filter = And(c.Filter, p.Filter)
+	} else if p.Filter != nil {
+		c.Filter = p.Filter
+	}
+	return c
+}
+
+// OnChange returns an OnChange that runs the steps of p in dir. The steps
+// after one that fails are skipped until the next cycle. Output goes to
+// stdout and stderr.
+func (p Preset) OnChange(dir string) func(ctx context.Context, cycle Cycle) bool {
+	log := p.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return func(ctx context.Context, cycle Cycle) bool {
+		log := log.With("cycle", cycle.ID)
+		ran := false
+		for _, step := range p.Steps {
+			if !ran && step.Filter != nil && !slices.ContainsFunc(cycle.Paths, step.Filter.Match) {
+				continue
+			}
+			cmd := exec.CommandContext(ctx, step.Command[0], step.Command[1:]...)
+			cmd.Dir = dir
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				log.Error("step failed", "step", step.Name, "error", err)
+				break
+			}
+			ran = true
+		}
+		return true
+	}
+}
@@ -0,0 +1,60 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookupPreset(t *testing.T) {
+	for _, name := range Presets() {
+		p, err := LookupPreset(name)
+		if err != nil || p.Name != name {
+			t.Errorf("%s: got %+v, %v", name, p, err)
+		}
+	}
+	if _, err := LookupPreset("nope"); err == nil {
+		t.Errorf("expected an error for an unknown preset")
+	}
+
+	p, _ := LookupPreset("templ")
+	p.Ignore[0] = "changed"
+	if again, _ := LookupPreset("templ"); again.Ignore[0] == "changed" {
+		t.Errorf("changing a preset changed the next lookup")
+	}
+
+	c := p.Apply(DefaultConfig())
+	if c.Debounce != p.Debounce || !slices.Contains(c.Ignore, "*_templ.txt") || !slices.Contains(c.Ignore, ".git") {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if !c.Filter.Match("a.templ") || c.Filter.Match("a.txt") {
+		t.Errorf("unexpected filter %v", c.Filter)
+	}
+}
+
+func TestPresetSteps(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not installed")
+	}
+	p := Preset{Steps: []Step{
+		{Name: "init", Command: []string{"go", "mod", "init", "m"}, Filter: Ext(".a")},
+		{Name: "edit", Command: []string{"go", "mod", "edit", "-module=n"}, Filter: Ext(".b")},
+	}}
+
+	dir := t.TempDir()
+	p.OnChange(dir)(context.Background(), Cycle{Paths: []string{"x.c"}})
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		t.Errorf("steps ran for unrelated changes")
+	}
+
+	// The second step runs after the first, even though no path matches it.
+	p.OnChange(dir)(context.Background(), Cycle{Paths: []string{"x.a"}})
+	mod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil || !strings.Contains(string(mod), "module n") {
+		t.Errorf("expected both steps to run, got %q, %v", mod, err)
+	}
+}
@@ -0,0 +1,403 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// hub is an fsnotify.Watcher shared by several watch sets: by those of every
+// watcher with Config.Share in the process for shared, or by those of the
+// loops of a watcher with Config.Handlers. Each watch set is a view of it
+// that only gets the events of the directories it added. A directory stays
+// watched while any view has it, and the watcher is closed with the last
+// view.
+type hub struct {
+	op sync.Mutex // serializes changes to the watches of w
+
+	mu    sync.Mutex
+	w     *fsnotify.Watcher
+	refs  map[string]int // longPath(dir) -> number of views that added it
+	views map[*sharedSource]struct{}
+}
+
+var shared = &hub{}
+
+// sharedSource is a Source that is a view of a hub.
+type sharedSource struct {
+	hub    *hub
+	dirs   map[string]bool // with longPath, guarded by hub.mu
+	events chan fsnotify.Event
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	queue  []any // fsnotify.Event or error, not yet delivered
+	notify chan struct{}
+}
+
+func newSharedSource() (Source, error) {
+	return shared.view()
+}
+
+// view returns a new view of h, creating its watcher if needed.
+func (h *hub) view() (*sharedSource, error) {
+	h.op.Lock()
+	defer h.op.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.w == nil {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		h.w, h.refs, h.views = w, map[string]int{}, map[*sharedSource]struct{}{}
+		go h.run(w)
+	}
+	s := &sharedSource{
+		hub:    h,
+		dirs:   map[string]bool{},
+		events: make(chan fsnotify.Event),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		notify: make(chan struct{}, 1),
+	}
+	h.views[s] = struct{}{}
+	go s.pump()
+	return s, nil
+}
+
+// run dispatches the events and errors of w until it is closed. Events keep
+// the paths fsnotify reports, with longPath, which walked.short undoes.
+func (h *hub) run(w *fsnotify.Watcher) {
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			h.mu.Lock()
+			for s := range h.views {
+				if s.dirs[filepath.Dir(ev.Name)] || s.dirs[ev.Name] {
+					s.push(ev)
+				}
+			}
+			h.mu.Unlock()
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			h.mu.Lock()
+			for s := range h.views {
+				s.push(err)
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+func (s *sharedSource) Add(path string) error {
+	path = longPath(path)
+	h := s.hub
+	h.op.Lock()
+	defer h.op.Unlock()
+	h.mu.Lock()
+	w := h.w
+	h.mu.Unlock()
+	if s.dirs[path] {
+		return nil
+	}
+	// Add even if another view has path: its watch is dropped with the
+	// directory, which may have been removed and created again since. Adding
+	// a path that is still watched is harmless.
+	if err := w.Add(path); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.refs[path] += 1
+	s.dirs[path] = true
+	h.mu.Unlock()
+	return nil
+}
+
+func (s *sharedSource) Remove(path string) error {
+	path = longPath(path)
+	h := s.hub
+	h.op.Lock()
+	defer h.op.Unlock()
+	h.mu.Lock()
+	if !s.dirs[path] {
+		h.mu.Unlock()
+		return nil
+	}
+	delete(s.dirs, path)
+	last := h.release(path)
+	w := h.w
+	h.mu.Unlock()
+	if last {
+		return w.Remove(path)
+	}
+	return nil
+}
+
+// release drops a reference to path, and reports whether it was the last.
+// h.mu must be held.
+func (h *hub) release(path string) bool {
+	h.refs[path] -= 1
+	if h.refs[path] > 0 {
+		return false
+	}
+	delete(h.refs, path)
+	return true
+}
+
+func (s *sharedSource) Events() <-chan fsnotify.Event { return s.events }
+func (s *sharedSource) Errors() <-chan error          { return s.errors }
+
+func (s *sharedSource) Close() error {
+	closed := false
+	s.once.Do(func() { closed = true })
+	if !closed {
+		return nil
+	}
+	close(s.done)
+
+	h := s.hub
+	h.op.Lock()
+	defer h.op.Unlock()
+	h.mu.Lock()
+	delete(h.views, s)
+	var unwatch []string
+	for dir := range s.dirs {
+		if h.release(dir) {
+			unwatch = append(unwatch, dir)
+		}
+	}
+	s.dirs = nil
+	w, last := h.w, len(h.views) == 0
+	if last {
+		h.w = nil
+	}
+	h.mu.Unlock()
+
+	if last {
+		return w.Close()
+	}
+	for _, dir := range unwatch {
+		w.Remove(dir) // may be gone already
+	}
+	return nil
+}
+
+// push queues v, an event or an error, for delivery without blocking the
+// hub on a view whose watcher is busy.
+func (s *sharedSource) push(v any) {
+	s.mu.Lock()
+	s.queue = append(s.queue, v)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pump delivers the queue of s in order until s is closed.
+func (s *sharedSource) pump() {
+	for {
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		if len(queue) == 0 {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		for _, v := range queue {
+			switch v := v.(type) {
+			case fsnotify.Event:
+				select {
+				case s.events <- v:
+				case <-s.done:
+					return
+				}
+			case error:
+				select {
+				case s.errors <- v:
+				case <-s.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// group is the loop run for the watchers with Config.Share and the same
+// shareKey, which each get its cycles, rescans and errors as members.
+type group struct {
+	key      string
+	coverage Coverage
+	cancel   context.CancelFunc
+	trigger  *trigger      // pushed to by the triggers of its members
+	done     chan struct{} // closed once the loop stopped, with err
+	err      error
+	members  map[*member]struct{} // guarded by groups
+}
+
+type member struct {
+	c    Config
+	left chan struct{} // closed when its OnChange returned false
+}
+
+var groups = struct {
+	sync.Mutex
+	m map[string]*group
+}{m: map[string]*group{}}
+
+// shareKey returns the key of the group c can join, if any: watchers that
+// walk the same Dirs and Globs with the same settings, and keep no state of
+// their own.
+func (c Config) shareKey() (string, bool) {
+	if !c.Share || c.FS != nil || c.NewSource != nil || len(c.Handlers) > 0 ||
+		c.Manifest != "" || c.DiffSize > 0 || c.Tree != nil || c.Latency != nil ||
+		c.Journal != "" || c.Initial || c.InitialScan || c.OnPanic != nil ||
+		len(c.Middleware) > 0 {
+		return "", false
+	}
+	filter := ""
+	if c.Filter != nil {
+		filter = c.Filter.String()
+	}
+	return fmt.Sprintf("%#v", []any{
+		c.Dirs, c.Globs, c.Debounce, c.Ignore, filter, c.FilterWorkers, c.IgnoreMetadata,
+		c.MaxDirs, c.PollUncovered, c.RaiseWatchLimit, c.AllowPartial, c.SameFilesystem, c.FollowSymlinks,
+		c.Poll, c.PollDirs, c.Reconcile, c.HaltOnRemove, c.Incremental, c.RescanRetries,
+		c.RescanBackoff, c.Restarts, c.RestartBackoff, c.Timeout, c.Stat, c.Trace,
+	}), true
+}
+
+// join adds c to the group of key, starting its loop if there is none. The
+// returned loop waits until ctx is done, OnChange returns false or the
+// group's loop fails, and then leaves the group.
+func (c Config) join(key string) (func(ctx context.Context) error, error) {
+	groups.Lock()
+	g := groups.m[key]
+	if g == nil {
+		g = &group{key: key, done: make(chan struct{}), members: map[*member]struct{}{}}
+		gc := c
+		gc.OnReady = func(coverage Coverage) { g.coverage = coverage }
+		gc.OnRescan = g.rescan
+		gc.OnRestart = g.restart
+		gc.OnError = g.error
+		gc.OnChange = g.change
+		gc.trigger = newTrigger()
+		g.trigger = gc.trigger
+		loop, err := gc.startLoop()
+		if err != nil {
+			groups.Unlock()
+			return nil, err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		g.cancel = cancel
+		go func() {
+			g.err = loop(ctx)
+			close(g.done)
+			groups.Lock()
+			if groups.m[key] == g {
+				delete(groups.m, key)
+			}
+			groups.Unlock()
+		}()
+		groups.m[key] = g
+	}
+	m := &member{c: c, left: make(chan struct{})}
+	g.members[m] = struct{}{}
+	if c.trigger != nil {
+		c.trigger.link(g.trigger)
+	}
+	coverage := g.coverage
+	groups.Unlock()
+
+	if c.OnReady != nil {
+		c.OnReady(coverage)
+	}
+	return func(ctx context.Context) error {
+		defer g.leave(m)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.left:
+			return nil
+		case <-g.done:
+			return g.err
+		}
+	}, nil
+}
+
+// leave removes m from g, and stops the loop of g with its last member. It
+// reports whether m was a member.
+func (g *group) leave(m *member) bool {
+	groups.Lock()
+	defer groups.Unlock()
+	if _, ok := g.members[m]; !ok {
+		return false
+	}
+	delete(g.members, m)
+	if len(g.members) == 0 {
+		if groups.m[g.key] == g {
+			delete(groups.m, g.key)
+		}
+		g.cancel()
+	}
+	return true
+}
+
+func (g *group) snapshot() []*member {
+	groups.Lock()
+	defer groups.Unlock()
+	members := make([]*member, 0, len(g.members))
+	for m := range g.members {
+		members = append(members, m)
+	}
+	return members
+}
+
+func (g *group) change(ctx context.Context, cycle Cycle) bool {
+	for _, m := range g.snapshot() {
+		if m.c.OnChange != nil && !m.c.OnChange(ctx, cycle) && g.leave(m) {
+			close(m.left)
+		}
+	}
+	return true
+}
+
+func (g *group) rescan(r Rescan) {
+	for _, m := range g.snapshot() {
+		if m.c.OnRescan != nil {
+			m.c.OnRescan(r)
+		}
+	}
+}
+
+func (g *group) restart(r Restart) {
+	for _, m := range g.snapshot() {
+		if m.c.OnRestart != nil {
+			m.c.OnRestart(r)
+		}
+	}
+}
+
+func (g *group) error(err error) {
+	for _, m := range g.snapshot() {
+		if m.c.OnError != nil {
+			m.c.OnError(err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestShare(t *testing.T) {
+	dir := t.TempDir()
+	// Different Debounce values keep the watchers from sharing a loop too.
+	start := func(debounce time.Duration) (chan<- struct{}, <-chan Cycle) {
+		cycles := make(chan Cycle, 10)
+		c := DefaultConfig()
+		c.Dirs = []string{dir}
+		c.Share = true
+		c.Debounce = debounce
+		c.OnChange = func(_ context.Context, cycle Cycle) bool {
+			cycles <- cycle
+			return true
+		}
+		halt, err := c.Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return halt, cycles
+	}
+	write := func(name string, cycles ...<-chan Cycle) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, ch := range cycles {
+			select {
+			case cycle := <-ch:
+				if !slices.Contains(cycle.Paths, path) {
+					t.Errorf("expected %s, got %v", path, cycle.Paths)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s was not seen", path)
+			}
+		}
+	}
+
+	halt1, cycles1 := start(20 * time.Millisecond)
+	halt2, cycles2 := start(30 * time.Millisecond)
+	shared.mu.Lock()
+	views, refs := len(shared.views), shared.refs[dir]
+	shared.mu.Unlock()
+	if views != 2 || refs != 2 {
+		t.Errorf("expected 2 views with %s added twice, got %d views and %d", dir, views, refs)
+	}
+	write("a", cycles1, cycles2)
+
+	halt1 <- struct{}{}
+	write("b", cycles2)
+
+	halt2 <- struct{}{}
+	deadline := time.Now().Add(time.Second)
+	for {
+		shared.mu.Lock()
+		w := shared.w
+		shared.mu.Unlock()
+		if w == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the shared watcher was not closed with its last view")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShareLoop(t *testing.T) {
+	dir := t.TempDir()
+	start := func(onchange func(context.Context, Cycle) bool) (chan<- struct{}, Coverage) {
+		c := DefaultConfig()
+		c.Dirs = []string{dir}
+		c.Share = true
+		c.Debounce = 20 * time.Millisecond
+		var coverage Coverage
+		c.OnReady = func(c Coverage) { coverage = c }
+		c.OnChange = onchange
+		halt, err := c.Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return halt, coverage
+	}
+
+	cycles1, cycles2 := make(chan Cycle, 10), make(chan Cycle, 10)
+	halt1, _ := start(func(_ context.Context, cycle Cycle) bool {
+		cycles1 <- cycle
+		return false
+	})
+	defer func() { halt1 <- struct{}{} }()
+	halt2, coverage := start(func(_ context.Context, cycle Cycle) bool {
+		cycles2 <- cycle
+		return true
+	})
+	defer func() { halt2 <- struct{}{} }()
+	if coverage.Dirs != 1 {
+		t.Errorf("expected the coverage of the shared loop, got %+v", coverage)
+	}
+	groups.Lock()
+	n := len(groups.m)
+	groups.Unlock()
+	if n != 1 {
+		t.Errorf("expected 1 shared loop, got %d", n)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case cycle := <-cycles2:
+			if !slices.Contains(cycle.Paths, path) {
+				t.Errorf("expected %s, got %v", path, cycle.Paths)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s was not seen", path)
+		}
+	}
+	// The first watcher stopped after its first cycle.
+	if got := len(cycles1); got != 1 {
+		t.Errorf("expected 1 cycle for the first watcher, got %d", got)
+	}
+}
+
+func TestShareRecreated(t *testing.T) {
+	dir := t.TempDir()
+	dist := filepath.Join(dir, "dist")
+	if err := os.Mkdir(dist, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Share = true
+	c.Debounce = 20 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	// The new watch set is a new view, which adds dist while the old view
+	// still holds it, although its watch was dropped with the directory.
+	if err := os.RemoveAll(dist); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dist, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-cycles:
+	case <-time.After(time.Second):
+		t.Fatal("the recreation of dist was not seen")
+	}
+	path := filepath.Join(dist, "f")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		if !slices.Contains(cycle.Paths, path) {
+			t.Errorf("expected %s, got %v", path, cycle.Paths)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s was not seen", path)
+	}
+}
+
+func TestShareKey(t *testing.T) {
+	c := DefaultConfig()
+	c.Dirs = []string{"a"}
+	c.Share = true
+	key, _ := c.shareKey()
+	for name, set := range map[string]func(c *Config){
+		"Stat":  func(c *Config) { c.Stat = true },
+		"Trace": func(c *Config) { c.Trace = true },
+	} {
+		other := c
+		set(&other)
+		if k, ok := other.shareKey(); !ok || k == key {
+			t.Errorf("expected a watcher with %s to not share the loop of one without", name)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package watch
+
+// isSharingViolation reports false: sharing violations only happen on
+// Windows.
+func isSharingViolation(err error) bool { return false }
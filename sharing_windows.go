@@ -0,0 +1,15 @@
+package watch
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errSharingViolation is ERROR_SHARING_VIOLATION.
+const errSharingViolation syscall.Errno = 32
+
+// isSharingViolation reports whether err is caused by another process having
+// a file open without sharing it.
+func isSharingViolation(err error) bool {
+	return err != nil && errors.Is(err, errSharingViolation)
+}
@@ -0,0 +1,20 @@
+package watch
+
+import (
+	"io/fs"
+	"testing"
+)
+
+func TestRetrySharing(t *testing.T) {
+	calls := 0
+	err := retrySharing(func() error {
+		calls++
+		if calls < 3 {
+			return &fs.PathError{Op: "open", Path: "x", Err: errSharingViolation}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on the third call, got %v after %d", err, calls)
+	}
+}
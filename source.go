@@ -0,0 +1,126 @@
+package watch
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Source is where a watcher gets its events from. By default each watch set
+// is an fsnotify.Watcher; tests can set Config.NewSource to feed synthetic
+// events instead.
+//
+// A new Source is created every time the watch set is rebuilt, and the
+// previous one is closed once the new one is ready.
+type Source interface {
+	// Add starts watching the directory at path.
+	Add(path string) error
+	// Events returns the channel events are delivered on.
+	Events() <-chan fsnotify.Event
+	// Errors returns the channel errors are delivered on.
+	Errors() <-chan error
+	// Close stops the source and releases its resources.
+	Close() error
+}
+
+// remover is implemented by Sources that can stop watching a directory, which
+// Config.Incremental uses for directories moved or removed.
+type remover interface {
+	Remove(path string) error
+}
+
+// fsnotifySource adapts an fsnotify.Watcher to Source.
+type fsnotifySource struct {
+	w *fsnotify.Watcher
+}
+
+func newFsnotifySource() (Source, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return fsnotifySource{w}, nil
+}
+
+func (s fsnotifySource) Add(path string) error         { return s.w.Add(longPath(path)) }
+func (s fsnotifySource) Events() <-chan fsnotify.Event { return s.w.Events }
+func (s fsnotifySource) Errors() <-chan error          { return s.w.Errors }
+func (s fsnotifySource) Close() error                  { return s.w.Close() }
+func (s fsnotifySource) Remove(path string) error      { return s.w.Remove(longPath(path)) }
+
+// watchSet is a Source along with what was found while populating it.
+type watchSet struct {
+	Source
+	walked
+	dirs int // number of directories added
+}
+
+func (w *watchSet) coverage() Coverage {
+	return Coverage{
+		Dirs:      w.dirs,
+		Roots:     w.roots,
+		Ignored:   w.ignored,
+		Uncovered: w.uncovered,
+		Failed:    w.failed,
+	}
+}
+
+// patch updates w for the directories created, moved or removed at the paths
+// of touched, instead of walking every root again. It returns an error if
+// that is not possible and w must be rebuilt instead, in which case w may
+// have been partially updated.
+func (w *watchSet) patch(c Config, touched map[string]fsnotify.Op) error {
+	if c.FollowSymlinks || c.MaxDirs > 0 {
+		return errors.New("FollowSymlinks and MaxDirs need a full rebuild")
+	}
+	paths := make([]string, 0, len(touched))
+	for path := range touched {
+		if slices.Contains(c.Dirs, path) || w.fileDirs[filepath.Dir(path)] {
+			return errors.New("a root or a match of Globs changed")
+		}
+		paths = append(paths, path)
+	}
+	// Parents sort before their children, so those are walked only once.
+	slices.Sort(paths)
+
+	r, _ := w.Source.(remover)
+	for _, path := range paths {
+		if touched[path]&(fsnotify.Remove|fsnotify.Rename) == 0 {
+			continue
+		}
+		for _, dir := range w.added.removeUnder(path) {
+			if r != nil {
+				r.Remove(dir) // usually gone already, so errors are expected
+			}
+			w.dirs -= 1
+		}
+	}
+	for _, path := range paths {
+		if !touched[path].Has(fsnotify.Create) || w.added.has(path) || !w.added.has(filepath.Dir(path)) {
+			continue
+		}
+		if info, err := c.stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		sub := c
+		sub.Dirs, sub.Globs = []string{path}, nil
+		walked, err := sub.walk(func(dir string) error {
+			if w.added.has(dir) {
+				return nil
+			}
+			if err := w.Add(dir); err != nil {
+				return err
+			}
+			w.added.add(dir)
+			w.dirs += 1
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		w.failed = append(w.failed, walked.failed...)
+	}
+	return nil
+}
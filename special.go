@@ -0,0 +1,33 @@
+package watch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// specialMode are the kinds of files that are never read: opening a FIFO
+// without a writer blocks forever, and reading a device may never end.
+const specialMode = fs.ModeNamedPipe | fs.ModeSocket | fs.ModeDevice | fs.ModeCharDevice | fs.ModeIrregular
+
+var errNotRegular = errors.New("not a regular file")
+
+// openRegular opens the file at path for reading if it is a regular file,
+// and fails with errNotRegular otherwise. It doesn't block on a FIFO, even
+// one that replaced a file checked before.
+func openRegular(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|openNonblock, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errNotRegular}
+	}
+	return f, nil
+}
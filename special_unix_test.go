@@ -0,0 +1,83 @@
+//go:build unix
+
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/unix"
+)
+
+func TestSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	file, fifo := filepath.Join(dir, "a.txt"), filepath.Join(dir, "pipe")
+	if err := os.WriteFile(file, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mkfifo(fifo, 0o644); err != nil {
+		t.Skipf("failed to make a FIFO: %v", err)
+	}
+
+	if _, err := openRegular(fifo); !errors.Is(err, errNotRegular) {
+		t.Errorf("expected errNotRegular for a FIFO, got %v", err)
+	}
+
+	// None of these must block on the FIFO, which has no writer.
+	cycles := make(chan Cycle, 1)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.InitialScan = true
+	c.DiffSize = 1024
+	c.Tree = &Tree{}
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return false
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+	select {
+	case cycle := <-cycles:
+		if !slices.Equal(cycle.Paths, []string{file}) {
+			t.Errorf("expected only %s, got %q", file, cycle.Paths)
+		}
+		if _, ok := c.Tree.FileHash(fifo); ok {
+			t.Errorf("the FIFO was hashed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked on the FIFO")
+	}
+	<-done
+
+	// Events for the FIFO don't reach cycles.
+	events := make(chan fsnotify.Event)
+	c = DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 10 * time.Millisecond
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Halt()
+	events <- fsnotify.Event{Name: fifo, Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: file, Op: fsnotify.Write}
+	select {
+	case cycle := <-cycles:
+		if !slices.Equal(cycle.Paths, []string{file}) {
+			t.Errorf("expected only %s, got %q", file, cycle.Paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no cycle")
+	}
+}
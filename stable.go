@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WaitStable blocks until the file at path has not changed size or
+// modification time for the `quiet` duration, and returns nil. Use it to
+// avoid processing files that are still being written, e.g. in an upload
+// directory. It returns early with an error if the file cannot be stat'ed
+// (e.g. because it was removed) or if ctx is done.
+//
+// The file is polled a few times per quiet period, so the wait may exceed
+// `quiet` by up to a quarter of it.
+func WaitStable(ctx context.Context, path string, quiet time.Duration) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	size, mtime, since := info.Size(), info.ModTime(), time.Now()
+
+	ticker := time.NewTicker(max(quiet/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if info.Size() != size || !info.ModTime().Equal(mtime) {
+				size, mtime, since = info.Size(), info.ModTime(), now
+			} else if now.Sub(since) >= quiet {
+				return nil
+			}
+		}
+	}
+}
+
+// WaitContent blocks until the file at path can be read and ok returns true
+// for its content, and returns that content. Use it to wait for the output
+// of another process, e.g. with bytes.Contains or json.Valid in ok, and with
+// a timeout on ctx. The directory of path is watched, and the file is read
+// again after each cycle; `debounce` and opts are as for WatchOnce.
+//
+// It returns early with the error of ctx once it is done, or with an error
+// if the watcher fails.
+func WaitContent(ctx context.Context, path string, debounce time.Duration, ok func(data []byte) bool, opts ...func(*Config)) ([]byte, error) {
+	var data []byte
+	err := Until(ctx, []string{filepath.Dir(path)}, debounce, func(ChangeSet) bool {
+		f, err := openRegular(path)
+		if err != nil {
+			return false // not there yet
+		}
+		defer f.Close()
+		data, err = io.ReadAll(f)
+		return err == nil && ok(data)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
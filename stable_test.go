@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitStable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	quiet := 50 * time.Millisecond
+	writes := 5
+	go func() {
+		for i := 0; i < writes; i++ {
+			time.Sleep(quiet / 2)
+			f.Write([]byte("chunk"))
+		}
+	}()
+
+	start := time.Now()
+	if err := WaitStable(context.Background(), path, quiet); err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if took := time.Since(start); took < time.Duration(writes)*quiet/2+quiet {
+		t.Errorf("returned after %v, before writes stopped", took)
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(writes*len("chunk")) {
+		t.Errorf("returned before all writes, size %d", info.Size())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WaitStable(ctx, path, quiet); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if err := WaitStable(context.Background(), path+".missing", quiet); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestWaitContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := WaitContent(ctx, path, 10*time.Millisecond, json.Valid, func(c *Config) {
+		c.OnReady = func(Coverage) {
+			go func() {
+				for _, content := range []string{`{"ok":`, `{"ok":true}`} {
+					if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+						t.Error(err)
+					}
+					time.Sleep(50 * time.Millisecond)
+				}
+			}()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"ok":true}` {
+		t.Errorf("got %q", data)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := WaitContent(short, path, 10*time.Millisecond, func([]byte) bool { return false }); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
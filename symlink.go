@@ -0,0 +1,87 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// symlinks records the symlinks followed while walking with
+// Config.FollowSymlinks, to map events on their targets back to the paths of
+// the links. Paths are kept with normPath, like the paths of events.
+type symlinks struct {
+	dirs  map[string]string // target directory -> link
+	files map[string]string // target file -> link
+	// watched are the directories walked normally or through a directory
+	// link. A target file's directory that is not in watched is only watched
+	// for that file, and events on its other entries are dropped.
+	watched map[string]bool
+}
+
+func newSymlinks() *symlinks {
+	return &symlinks{
+		dirs:    map[string]string{},
+		files:   map[string]string{},
+		watched: map[string]bool{},
+	}
+}
+
+// follow resolves the symlink at path. A link to a directory has its target
+// walked with walkdir; a link to a file has the file's directory added with
+// add. Broken links and links to targets that were already followed are
+// skipped.
+func (s *symlinks) follow(path string, walkdir func(root string) error, add func(path string) error) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil // broken link
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil
+	}
+	key := normPath(target)
+	if info.IsDir() {
+		if _, ok := s.dirs[key]; ok || s.watched[key] {
+			return nil
+		}
+		s.dirs[key] = normPath(path)
+		return walkdir(target)
+	}
+	if _, ok := s.files[key]; ok {
+		return nil
+	}
+	s.files[key] = normPath(path)
+	return add(filepath.Dir(target))
+}
+
+// resolve maps an event path on a link target back to the path through the
+// link. It returns false for events in a file link's directory that are not
+// about a linked file.
+func (s *symlinks) resolve(path string) (string, bool) {
+	if s == nil {
+		return path, true
+	}
+	if _, ok := s.files[path]; !ok && !s.watched[path] && !s.watched[filepath.Dir(path)] {
+		return path, false
+	}
+	// Links can point into other link targets, so resolve until no link
+	// matches. Every link was found by walking a path visited before its
+	// target, so this ends.
+	for {
+		if link, ok := s.files[path]; ok {
+			path = link
+			continue
+		}
+		resolved := false
+		for dir := path; !resolved; dir = filepath.Dir(dir) {
+			if link, ok := s.dirs[dir]; ok {
+				path = link + path[len(dir):]
+				resolved = true
+			} else if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+		if !resolved {
+			return path, true
+		}
+	}
+}
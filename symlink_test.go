@@ -0,0 +1,90 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	root, store := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(store, "lib/sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"conf.txt", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(store, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(store, "lib"), filepath.Join(root, "lib")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(store, "conf.txt"), filepath.Join(root, "conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	cycles := make(chan Cycle)
+	rescans := make(chan Rescan, 1)
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	c.Debounce = 20 * time.Millisecond
+	c.FollowSymlinks = true
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+
+	var dryrun []string
+	_, err := c.walk(func(path string) error {
+		dryrun = append(dryrun, path)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// conf is walked before lib, adding the store for conf.txt
+	want := []string{root, store, filepath.Join(store, "lib"), filepath.Join(store, "lib/sub")}
+	if !slices.Equal(dryrun, want) {
+		t.Errorf("walked %q, want %q", dryrun, want)
+	}
+
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	for _, tc := range []struct {
+		write string
+		want  string
+	}{
+		{"lib/sub/x.go", filepath.Join(root, "lib/sub/x.go")},
+		{"conf.txt", filepath.Join(root, "conf")},
+	} {
+		if err := os.WriteFile(filepath.Join(store, tc.write), []byte("x"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case cycle := <-cycles:
+			if !slices.Contains(cycle.Paths, tc.want) {
+				t.Errorf("writing %s: expected %s in %q", tc.write, tc.want, cycle.Paths)
+			}
+			<-rescans
+		case <-time.After(time.Second):
+			t.Fatalf("writing %s: no change detected", tc.write)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(store, "other.txt"), []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		t.Errorf("unlinked file next to a linked file triggered a change: %q", cycle.Paths)
+	case <-time.After(5 * c.Debounce):
+	}
+}
@@ -0,0 +1,65 @@
+// Package tlscert reloads a TLS key pair when its files change. It is a
+// package of its own so that the watch package doesn't import crypto/tls,
+// and with it the net package.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+
+	"github.com/infogulch/watch"
+)
+
+// Watch loads the key pair of certFile and keyFile, and loads it
+// again whenever either changes, until ctx is done. Use the returned function
+// as tls.Config.GetCertificate.
+//
+// The directories of the files are watched rather than the files, so that a
+// key pair replaced by swapping a symlink is seen, as cert-manager does with
+// the ..data link of a Kubernetes secret volume and certbot with the links in
+// its live directory. A pair that fails to load, e.g. a new certificate next
+// to the old key while both are being replaced, is reported to onError, if not
+// nil, and the previous one is kept.
+func Watch(ctx context.Context, certFile, keyFile string, onError func(error)) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key pair: %w", err)
+	}
+	var current atomic.Pointer[tls.Certificate]
+	current.Store(&cert)
+
+	c := watch.DefaultConfig()
+	c.Dirs = []string{filepath.Dir(certFile)}
+	if dir := filepath.Dir(keyFile); !slices.Contains(c.Dirs, dir) {
+		c.Dirs = append(c.Dirs, dir)
+	}
+	c.OnChange = func(context.Context, watch.Cycle) bool {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			if onError != nil {
+				onError(fmt.Errorf("failed to reload key pair: %w", err))
+			}
+			return true
+		}
+		current.Store(&cert)
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Halt()
+		case <-w.Done():
+		}
+	}()
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return current.Load(), nil
+	}, nil
+}
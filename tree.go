@@ -0,0 +1,183 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Tree is a content-addressed view of the files under Config.Dirs: every file
+// is hashed with SHA-256, and every directory's hash rolls up the names and
+// hashes of its entries. Set Config.Tree to have the watcher build it on
+// start and bring it up to date before every call to OnChange. Directories
+// are represented only by the files under them, so empty directories have no
+// hash.
+//
+// The zero value is an empty tree. A Tree is safe for concurrent use, but
+// must not be shared by more than one watcher.
+type Tree struct {
+	mu    sync.RWMutex
+	roots []string
+	files map[string]string // path -> hex hash of content
+	dirs  map[string]string // path -> hex hash of entries
+}
+
+// Hash returns the hash of all roots, or "" if the tree is empty. It changes
+// if and only if the content or name of some file changed.
+func (t *Tree) Hash() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.files) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, root := range t.roots {
+		fmt.Fprintf(h, "%s\x00%s\n", root, t.dirs[root])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DirHash returns the hash of the directory at path, which must be spelled
+// like the roots in Config.Dirs and the paths under them.
+func (t *Tree) DirHash(path string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	hash, ok := t.dirs[filepath.Clean(path)]
+	return hash, ok
+}
+
+// FileHash returns the hash of the content of the file at path.
+func (t *Tree) FileHash(path string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	hash, ok := t.files[filepath.Clean(path)]
+	return hash, ok
+}
+
+// build replaces the content of t with every file under c.Dirs.
+func (t *Tree) build(c Config) error {
+	files := map[string]string{}
+	err := c.walkFiles(func(path string, d fs.DirEntry) error {
+		return hashInto(files, path)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build tree: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.roots = t.roots[:0]
+	for _, root := range c.Dirs {
+		t.roots = append(t.roots, filepath.Clean(root))
+	}
+	t.files = files
+	t.rollup()
+	return nil
+}
+
+// update rehashes the given changed paths. A path that is now a directory is
+// walked, and files under a path that no longer exists are removed.
+func (t *Tree) update(c Config, paths []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var errs []error
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		prefix := path + string(filepath.Separator)
+		for file := range t.files {
+			if file == path || strings.HasPrefix(file, prefix) {
+				delete(t.files, file)
+			}
+		}
+		sub := c
+		sub.Dirs = []string{path}
+		err := sub.walkFiles(func(path string, d fs.DirEntry) error {
+			return hashInto(t.files, path)
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	t.rollup()
+	return errors.Join(errs...)
+}
+
+// hashInto adds the hash of the regular file at path to files. Other kinds of
+// files, and files removed before they could be read, are skipped.
+func hashInto(files map[string]string, path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := openRegular(path)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errNotRegular) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	files[path] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// rollup recomputes every directory hash from t.files. t.mu must be held.
+func (t *Tree) rollup() {
+	isRoot := map[string]bool{}
+	for _, root := range t.roots {
+		isRoot[root] = true
+	}
+
+	// entries maps each directory to "name\x00hash" lines for its children.
+	entries := map[string][]string{}
+	for path, hash := range t.files {
+		dir := filepath.Dir(path)
+		entries[dir] = append(entries[dir], filepath.Base(path)+"\x00"+hash)
+		for !isRoot[dir] && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+			if _, ok := entries[dir]; !ok {
+				entries[dir] = nil
+			}
+		}
+	}
+
+	// Hash the deepest directories first so their hashes are known when
+	// their parents are hashed.
+	dirs := make([]string, 0, len(entries))
+	for dir := range entries {
+		dirs = append(dirs, dir)
+	}
+	depth := func(path string) int { return strings.Count(path, string(filepath.Separator)) }
+	slices.SortFunc(dirs, func(a, b string) int { return depth(b) - depth(a) })
+
+	t.dirs = make(map[string]string, len(dirs))
+	for _, dir := range dirs {
+		lines := entries[dir]
+		slices.Sort(lines)
+		h := sha256.New()
+		for _, line := range lines {
+			io.WriteString(h, line+"\n")
+		}
+		t.dirs[dir] = hex.EncodeToString(h.Sum(nil))
+		if !isRoot[dir] && filepath.Dir(dir) != dir {
+			parent := filepath.Dir(dir)
+			entries[parent] = append(entries[parent], filepath.Base(dir)+"/\x00"+t.dirs[dir])
+		}
+	}
+}
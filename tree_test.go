@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a := write("a.txt", "a")
+	b := write("sub/b.txt", "b")
+	write("other/c.txt", "c")
+
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	var tree Tree
+	if err := tree.build(c); err != nil {
+		t.Fatal(err)
+	}
+	hash := tree.Hash()
+	sub, _ := tree.DirHash(filepath.Join(root, "sub"))
+	other, _ := tree.DirHash(filepath.Join(root, "other"))
+	if hash == "" || sub == "" || other == "" {
+		t.Fatalf("missing hashes: %q %q %q", hash, sub, other)
+	}
+
+	// Rewriting a file with the same content changes nothing.
+	write("sub/b.txt", "b")
+	if err := tree.update(c, []string{b}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Hash() != hash {
+		t.Errorf("tree hash changed without content changes")
+	}
+
+	// Changing a file changes its directory and the root, but not siblings.
+	write("sub/b.txt", "bb")
+	if err := tree.update(c, []string{b}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := tree.DirHash(filepath.Join(root, "sub")); got == sub {
+		t.Errorf("sub hash did not change")
+	}
+	if got, _ := tree.DirHash(filepath.Join(root, "other")); got != other {
+		t.Errorf("other hash changed")
+	}
+	if tree.Hash() == hash {
+		t.Errorf("tree hash did not change")
+	}
+
+	// Removing a directory removes its hash.
+	if err := os.RemoveAll(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.update(c, []string{filepath.Join(root, "sub")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.DirHash(filepath.Join(root, "sub")); ok {
+		t.Errorf("removed directory still has a hash")
+	}
+	if _, ok := tree.FileHash(a); !ok {
+		t.Errorf("missing hash for %s", a)
+	}
+}
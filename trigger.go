@@ -0,0 +1,47 @@
+package watch
+
+import "sync"
+
+// trigger queues the cycles requested with Watcher.Trigger until the loop
+// takes them, so that Trigger doesn't wait for a busy OnChange.
+type trigger struct {
+	mu     sync.Mutex
+	paths  []string
+	next   []*trigger // of the loops of Handlers or of a shared group
+	notify chan struct{}
+}
+
+func newTrigger() *trigger {
+	return &trigger{notify: make(chan struct{}, 1)}
+}
+
+// link makes every push to t push to next as well, for another loop.
+func (t *trigger) link(next *trigger) {
+	t.mu.Lock()
+	t.next = append(t.next, next)
+	t.mu.Unlock()
+}
+
+// push requests a cycle with paths, merged with any not yet taken.
+func (t *trigger) push(paths []string) {
+	t.mu.Lock()
+	t.paths = append(t.paths, paths...)
+	next := t.next
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+	for _, n := range next {
+		n.push(paths)
+	}
+}
+
+// take returns the paths of the requested cycles since the last take.
+func (t *trigger) take() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	paths := t.paths
+	t.paths = nil
+	return paths
+}
@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// WatchValue parses the file at path and parses it again whenever it
+// changes, until ctx is done, storing each value in the returned pointer. It
+// is meant for configuration files: parse decodes and validates the content,
+// and a change it fails on is reported to onError, if not nil, while the
+// previous value is kept.
+//
+// The file is watched as a root of its own, through its directory, so that
+// it is still seen after being replaced by a rename, and the other entries of
+// the directory are not watched. It is only parsed again when its content
+// changed.
+func WatchValue[T any](ctx context.Context, path string, parse func([]byte) (T, error), onError func(error)) (*atomic.Pointer[T], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var value atomic.Pointer[T]
+	value.Store(&v)
+
+	c := DefaultConfig()
+	c.Dirs = []string{path}
+	c.OnChange = func(context.Context, Cycle) bool {
+		next, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(next, data) {
+			return true
+		}
+		var v T
+		if err == nil {
+			v, err = parse(next)
+			if err != nil {
+				err = fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		}
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			return true
+		}
+		data = next
+		value.Store(&v)
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Halt()
+		case <-w.Done():
+		}
+	}()
+	return &value, nil
+}
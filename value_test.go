@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchValue(t *testing.T) {
+	type settings struct{ Port int }
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte(`{"Port": 80}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	parse := func(data []byte) (settings, error) {
+		var s settings
+		if err := json.Unmarshal(data, &s); err != nil {
+			return s, err
+		}
+		if s.Port <= 0 {
+			return s, errors.New("invalid port")
+		}
+		return s, nil
+	}
+	errs := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	value, err := WatchValue(ctx, path, parse, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := value.Load().Port; port != 80 {
+		t.Fatalf("expected port 80, got %d", port)
+	}
+
+	// An invalid value is reported and the previous one kept.
+	if err := os.WriteFile(path, []byte(`{"Port": -1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("the invalid value was not reported")
+	}
+	if port := value.Load().Port; port != 80 {
+		t.Errorf("expected port 80 to be kept, got %d", port)
+	}
+
+	// A file replaced by a rename is parsed again.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(`{"Port": 8080}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for value.Load().Port != 8080 {
+		if time.Now().After(deadline) {
+			t.Fatal("the new value was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
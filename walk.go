@@ -0,0 +1,368 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// walk calls add for every directory under c.Dirs, roots included, that is not
+// ignored, and for the directory of every root that is a file. If skip is not
+// nil, it is called for every directory excluded by an Ignore pattern; the
+// directory's subtree is not walked.
+//
+// With c.FollowSymlinks, the targets of symlinks are watched too: add is called
+// for every directory under a linked directory, and for the directory of a
+// linked file.
+//
+// Once add has been called c.MaxDirs times, the remaining directories are not
+// added nor walked, and are listed in walked.uncovered instead.
+//
+// With c.AllowPartial, directories that fail to be read or added are listed in
+// walked.failed and their subtree is skipped, instead of stopping the walk.
+func (c Config) walk(add func(path string) error, skip func(path, pattern string)) (walked, error) {
+	var w walked
+	roots := c.roots()
+	w.roots = make([]RootCoverage, len(roots))
+	// relative records the absolute path of a relative root or directory,
+	// which longPath may give fsnotify instead.
+	relative := func(path string) {
+		if filepath.IsAbs(path) || c.FS != nil {
+			return
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			w.relative = append(w.relative, [2]string{abs, path})
+		}
+	}
+	root := 0 // index of the root being walked, or -1 for the dirs of c.Globs
+	if c.FollowSymlinks {
+		w.links = newSymlinks()
+	}
+	count := 0
+	added := map[string]bool{}
+	w.added = newPathSet(c.FS != nil)
+	// addDir adds path once. Directories of linked files are not marked as
+	// watched, so that only events for the linked files are kept.
+	addDir := func(path string, watched bool) error {
+		if w.links != nil {
+			if added[path] {
+				if watched {
+					w.links.watched[normPath(path)] = true
+				}
+				return nil
+			}
+		}
+		if w.added.has(path) {
+			return nil // e.g. under an earlier root, or walked again after a retry
+		}
+		if c.MaxDirs > 0 && count >= c.MaxDirs {
+			w.uncovered = append(w.uncovered, path)
+			return filepath.SkipDir
+		}
+		if w.links != nil {
+			if watched {
+				w.links.watched[normPath(path)] = true
+			}
+			added[path] = true
+		}
+		err := retrySharing(func() error { return add(path) })
+		if err != nil && c.AllowPartial {
+			w.failed = append(w.failed, &fs.PathError{Op: "add", Path: path, Err: err})
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		count += 1
+		w.added.add(path)
+		if root >= 0 {
+			w.roots[root].Dirs += 1
+		}
+		return nil
+	}
+
+	retrying := map[string]bool{}
+	var walkdir func(root string) error
+	walkdir = func(root string) error {
+		walkDir := c.walkDir
+		if c.listings != nil && c.FS == nil {
+			walkDir = c.listings.walk
+		}
+		var dev uint64 // of root, with c.SameFilesystem
+		return walkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if isSharingViolation(err) && retrying[path] {
+				return err
+			} else if isSharingViolation(err) {
+				// Walk the directory again, as WalkDir can't retry it. The
+				// retries of path fail without retrying again.
+				retrying[path] = true
+				err = retrySharing(func() error { return walkdir(path) })
+				delete(retrying, path)
+				if err == nil {
+					return filepath.SkipDir
+				}
+			}
+			if err != nil && c.AllowPartial {
+				w.failed = append(w.failed, &fs.PathError{Op: "walk", Path: path, Err: err})
+				return nil
+			} else if err != nil {
+				return err
+			}
+			isLink := w.links != nil && d.Type()&fs.ModeSymlink != 0
+			if !d.IsDir() && !isLink {
+				return nil
+			}
+			if path != root {
+				if pattern := c.ignoredBy(path); pattern != "" {
+					w.ignored = append(w.ignored, Ignored{Path: path, Pattern: pattern})
+					if skip != nil {
+						skip(path, pattern)
+					}
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			if c.SameFilesystem && d.IsDir() {
+				if path == root {
+					dev, _ = deviceOf(d)
+				} else if other, ok := deviceOf(d); ok && other != dev {
+					w.ignored = append(w.ignored, Ignored{Path: path})
+					if skip != nil {
+						skip(path, "")
+					}
+					return filepath.SkipDir
+				}
+			}
+			if isLink {
+				return w.links.follow(path, walkdir, func(dir string) error {
+					if err := addDir(dir, false); err != filepath.SkipDir {
+						return err
+					}
+					return nil // don't skip the link's siblings
+				})
+			}
+			return addDir(path, true)
+		})
+	}
+	// addOnly adds dir, unless it is added already, so that only events for
+	// some of its entries are kept.
+	addOnly := func(dir string) error {
+		if w.added.has(dir) || w.fileDirs[normPath(dir)] {
+			return nil
+		}
+		if w.fileDirs == nil {
+			w.fileDirs = map[string]bool{}
+		}
+		w.fileDirs[normPath(dir)] = true
+		relative(dir)
+		if err := addDir(dir, false); err != nil && err != filepath.SkipDir {
+			return fmt.Errorf("failed scanning for directories: %w", err)
+		}
+		return nil
+	}
+
+	var files []int
+	for i, path := range roots {
+		w.roots[i].Path = path
+		if info, err := c.stat(path); err == nil && !info.IsDir() {
+			files = append(files, i)
+			continue
+		}
+		root = i
+		relative(path)
+		if err := walkdir(path); err != nil {
+			return w, fmt.Errorf("failed scanning for directories: %w", err)
+		}
+	}
+	// Roots that are files are watched through their directory, to still be
+	// seen after being replaced by a rename, unless it is watched already.
+	for _, i := range files {
+		root = i
+		file := roots[i]
+		if w.files == nil {
+			w.files = map[string]bool{}
+		}
+		w.files[normPath(file)] = true
+		if err := addOnly(filepath.Dir(file)); err != nil {
+			return w, err
+		}
+	}
+	// The directories of c.Globs are watched for new matches the same way.
+	root = -1
+	for _, pattern := range c.Globs {
+		pattern = filepath.Clean(pattern)
+		w.globs = append(w.globs, normPath(pattern))
+		if err := addOnly(filepath.Dir(pattern)); err != nil {
+			return w, err
+		}
+	}
+	return w, nil
+}
+
+// retrySharing calls fn again, a few times, while it fails with a sharing
+// violation, which happens on Windows while another process has a file open
+// without sharing it.
+func retrySharing(fn func() error) error {
+	err := fn()
+	for i := 1; i <= 5 && isSharingViolation(err); i++ {
+		time.Sleep(time.Duration(i) * 20 * time.Millisecond)
+		err = fn()
+	}
+	return err
+}
+
+// roots returns c.Dirs followed by the current matches of c.Globs that are
+// neither in c.Dirs nor ignored.
+func (c Config) roots() []string {
+	roots := c.Dirs
+	for _, pattern := range c.Globs {
+		var matches []string
+		if c.FS != nil {
+			matches, _ = fs.Glob(c.FS, filepath.Clean(pattern))
+		} else {
+			matches, _ = filepath.Glob(filepath.Clean(pattern))
+		}
+		for _, match := range matches {
+			if !slices.Contains(roots, match) && c.ignoredBy(match) == "" {
+				roots = append(roots[:len(roots):len(roots)], match)
+			}
+		}
+	}
+	return roots
+}
+
+// stat is os.Stat, or fs.Stat in c.FS if it is set.
+func (c Config) stat(path string) (fs.FileInfo, error) {
+	if c.FS != nil {
+		return fs.Stat(c.FS, path)
+	}
+	return os.Stat(path)
+}
+
+// walkDir is filepath.WalkDir, or fs.WalkDir in c.FS if it is set.
+func (c Config) walkDir(root string, fn fs.WalkDirFunc) error {
+	if c.FS != nil {
+		return fs.WalkDir(c.FS, root, fn)
+	}
+	return filepath.WalkDir(root, fn)
+}
+
+// walked is what walk found besides the directories it added. The paths it
+// looks events up by, in added, files, globs, fileDirs and links, are kept
+// with normPath, like the paths of events.
+type walked struct {
+	links     *symlinks       // nil unless c.FollowSymlinks
+	uncovered []string        // directories not added because of c.MaxDirs
+	failed    []*fs.PathError // directories that failed, with c.AllowPartial
+	added     *pathSet        // directories added
+	roots     []RootCoverage  // directories added per root, without Backend
+	ignored   []Ignored       // directories excluded by c.Ignore
+	files     map[string]bool // roots that are files
+	globs     []string        // c.Globs, cleaned
+	fileDirs  map[string]bool // directories added only for files and globs
+	relative  [][2]string     // absolute and relative paths of relative roots
+}
+
+// short returns path, from fsnotify, as it was walked: without the
+// extended-length prefix of longPath, and relative again if longPath made
+// it absolute.
+func (w walked) short(path string) string {
+	short := shortPath(path)
+	if short == path {
+		return path
+	}
+	for _, r := range w.relative {
+		if under(short, r[0]) {
+			return filepath.Join(r[1], short[len(r[0]):])
+		}
+	}
+	return short
+}
+
+// keep reports whether an event for path is about a watched path, rather
+// than a sibling of a root that is a file or of the matches of a glob.
+func (w walked) keep(path string) bool {
+	if !w.fileDirs[filepath.Dir(path)] || w.files[path] {
+		return true
+	}
+	for _, pattern := range w.globs {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkFiles calls fn for every file under c.Dirs and the matches of c.Globs
+// that is not ignored and is not in an ignored directory. FIFOs, sockets and
+// devices are left out.
+func (c Config) walkFiles(fn func(path string, d fs.DirEntry) error) error {
+	for _, root := range c.roots() {
+		var dev uint64 // of root, with c.SameFilesystem
+		err := c.walkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != root && c.ignoredBy(path) != "" {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if c.SameFilesystem && d.IsDir() {
+				if path == root {
+					dev, _ = deviceOf(d)
+				} else if other, ok := deviceOf(d); ok && other != dev {
+					return filepath.SkipDir
+				}
+			}
+			if d.IsDir() || d.Type()&specialMode != 0 {
+				return nil
+			}
+			return fn(path, d)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DryRun walks c.Dirs exactly like Watch would, without starting a watcher,
+// and writes one line per directory to w: "watch <path>" for directories that
+// would be watched, "skip <path> <pattern>" for directories excluded by an
+// Ignore pattern, "skip <path> (mount point)" for directories excluded by
+// SameFilesystem, "uncovered <path>" for directories left out because of
+// MaxDirs, and "failed <path> <error>" for directories that could not be read
+// with AllowPartial. OnChange may be nil.
+func (c Config) DryRun(w io.Writer) error {
+	if c.OnChange == nil {
+		c.OnChange = func(context.Context, Cycle) bool { return false } // never called
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	walked, err := c.walk(func(path string) error {
+		_, err := fmt.Fprintf(w, "watch %s\n", path)
+		return err
+	}, func(path, pattern string) {
+		if pattern == "" {
+			fmt.Fprintf(w, "skip %s (mount point)\n", path)
+			return
+		}
+		fmt.Fprintf(w, "skip %s %s\n", path, pattern)
+	})
+	for _, path := range walked.uncovered {
+		fmt.Fprintf(w, "uncovered %s\n", path)
+	}
+	for _, err := range walked.failed {
+		fmt.Fprintf(w, "failed %s %v\n", err.Path, err.Err)
+	}
+	return err
+}
@@ -0,0 +1,336 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src/pkg", ".git/objects", "node_modules/x"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	var out strings.Builder
+	if err := c.DryRun(&out); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"watch " + root,
+		"skip " + filepath.Join(root, ".git") + " .git",
+		"skip " + filepath.Join(root, "node_modules") + " node_modules",
+		"watch " + filepath.Join(root, "src"),
+		"watch " + filepath.Join(root, "src/pkg"),
+		"",
+	}, "\n")
+	if got := out.String(); got != want {
+		t.Errorf("unexpected dry run output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDryRunMaxDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/aa", "b/bb", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	c.MaxDirs = 3
+	var out strings.Builder
+	if err := c.DryRun(&out); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"watch " + root,
+		"watch " + filepath.Join(root, "a"),
+		"watch " + filepath.Join(root, "a/aa"),
+		"uncovered " + filepath.Join(root, "b"),
+		"uncovered " + filepath.Join(root, "c"),
+		"",
+	}, "\n")
+	if got := out.String(); got != want {
+		t.Errorf("unexpected dry run output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// failingSource fails to add directories named "bad".
+type failingSource struct {
+	fakeSource
+}
+
+func (s failingSource) Add(path string) error {
+	if filepath.Base(path) == "bad" {
+		return errors.New("no space left")
+	}
+	return nil
+}
+
+func TestAllowPartial(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"good", "bad/sub"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var coverage Coverage
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	c.NewSource = func() (Source, error) { return failingSource{}, nil }
+	c.OnReady = func(cov Coverage) { coverage = cov }
+	c.OnChange = func(context.Context, Cycle) bool { return true }
+
+	if _, err := c.Watch(); err == nil {
+		t.Fatalf("expected failure without AllowPartial")
+	}
+
+	c.AllowPartial = true
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatalf("expected success with AllowPartial: %v", err)
+	}
+	halt <- struct{}{}
+	if coverage.Dirs != 2 || len(coverage.Failed) != 1 || coverage.Failed[0].Path != filepath.Join(root, "bad") {
+		t.Errorf("unexpected coverage: %+v", coverage)
+	}
+}
+
+func TestFileRoot(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(file, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{file}
+	c.Debounce = 20 * time.Millisecond
+	var coverage Coverage
+	c.OnReady = func(c Coverage) { coverage = c }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+	if coverage.Dirs != 1 {
+		t.Errorf("expected the file's directory to be watched, got %+v", coverage)
+	}
+
+	// Siblings are dropped, and replacing the file by a rename is seen.
+	if err := os.WriteFile(filepath.Join(dir, "other"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "app.conf.tmp")
+	if err := os.WriteFile(tmp, []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		if !slices.Equal(cycle.Paths, []string{file}) {
+			t.Errorf("expected only %s, got %v", file, cycle.Paths)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the replaced file was not seen")
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{"x/y", ".git/objects"} {
+		if err := os.MkdirAll(filepath.Join(a, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := DefaultConfig()
+	c.Dirs = []string{a, b}
+	c.NewSource = func() (Source, error) { return fakeSource{}, nil }
+	c.OnChange = func(context.Context, Cycle) bool { return true }
+	var coverage Coverage
+	c.OnReady = func(c Coverage) { coverage = c }
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	halt <- struct{}{}
+
+	want := []RootCoverage{{Path: a, Dirs: 3, Backend: "custom"}, {Path: b, Dirs: 1, Backend: "custom"}}
+	if coverage.Dirs != 4 || !slices.Equal(coverage.Roots, want) {
+		t.Errorf("expected 4 dirs in %v, got %+v", want, coverage)
+	}
+	ignored := []Ignored{{Path: filepath.Join(a, ".git"), Pattern: ".git"}}
+	if !slices.Equal(coverage.Ignored, ignored) {
+		t.Errorf("expected ignored %v, got %v", ignored, coverage.Ignored)
+	}
+}
+
+func TestGlobs(t *testing.T) {
+	projects := t.TempDir()
+	if err := os.Mkdir(filepath.Join(projects, "p-a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cycles := make(chan Cycle, 10)
+	rescans := make(chan Rescan, 10)
+	c := DefaultConfig()
+	c.Globs = []string{filepath.Join(projects, "p-*")}
+	c.Debounce = 20 * time.Millisecond
+	var coverage Coverage
+	c.OnReady = func(c Coverage) { coverage = c }
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+	if coverage.Dirs != 2 || len(coverage.Roots) != 1 || coverage.Roots[0].Path != filepath.Join(projects, "p-a") {
+		t.Errorf("expected p-a and its parent to be watched, got %+v", coverage)
+	}
+
+	expect := func(op func() error, paths []string, dirs int) {
+		t.Helper()
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case cycle := <-cycles:
+			if !slices.Equal(cycle.Paths, paths) {
+				t.Errorf("expected %v, got %v", paths, cycle.Paths)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no cycle for %v", paths)
+		}
+		if r := <-rescans; r.Dirs != dirs {
+			t.Errorf("expected %d dirs, got %+v", dirs, r)
+		}
+	}
+
+	// Non-matching entries are dropped, new matches are watched.
+	b := filepath.Join(projects, "p-b")
+	expect(func() error {
+		if err := os.Mkdir(filepath.Join(projects, "other"), 0o755); err != nil {
+			return err
+		}
+		return os.Mkdir(b, 0o755)
+	}, []string{b}, 3)
+	expect(func() error {
+		return os.WriteFile(filepath.Join(b, "x"), nil, 0o644)
+	}, []string{filepath.Join(b, "x")}, 3)
+	expect(func() error { return os.Remove(filepath.Join(b, "x")) }, []string{filepath.Join(b, "x")}, 3)
+	expect(func() error { return os.Remove(b) }, []string{b}, 2)
+}
+
+// BenchmarkRescan measures a walk of a tree of 1111 directories with 5 files
+// each, as done to rebuild the watch set after every cycle, reading every
+// directory and reusing their listings.
+func BenchmarkRescan(b *testing.B) {
+	root := b.TempDir()
+	old := time.Now().Add(-time.Hour)
+	var mkdirs func(dir string, depth int)
+	mkdirs = func(dir string, depth int) {
+		for i := 0; i < 5; i++ {
+			if err := os.WriteFile(filepath.Join(dir, "file"+strconv.Itoa(i)), nil, 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for i := 0; i < 10 && depth > 0; i++ {
+			sub := filepath.Join(dir, "dir"+strconv.Itoa(i))
+			if err := os.Mkdir(sub, 0o755); err != nil {
+				b.Fatal(err)
+			}
+			mkdirs(sub, depth-1)
+		}
+		// Listings of directories changed just before are not reused.
+		if err := os.Chtimes(dir, old, old); err != nil {
+			b.Fatal(err)
+		}
+	}
+	mkdirs(root, 3)
+
+	for _, cached := range []bool{false, true} {
+		c := DefaultConfig()
+		c.Dirs = []string{root}
+		name := "read"
+		if cached {
+			c.listings = newListings()
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w, err := c.walk(func(string) error { return nil }, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if w.added.len() != 1111 {
+					b.Fatalf("expected 1111 directories, got %d", w.added.len())
+				}
+			}
+		})
+	}
+}
+
+func TestSameFilesystem(t *testing.T) {
+	// /dev/shm is usually a tmpfs mounted on /dev.
+	dev, err := os.Stat("/dev")
+	if err != nil {
+		t.Skip("no /dev")
+	}
+	shm, err := os.Stat("/dev/shm")
+	if err != nil || !shm.IsDir() {
+		t.Skip("no /dev/shm")
+	}
+	a, _ := deviceOf(fs.FileInfoToDirEntry(dev))
+	b, ok := deviceOf(fs.FileInfoToDirEntry(shm))
+	if !ok || a == b {
+		t.Skip("/dev/shm is not a mount point")
+	}
+
+	c := DefaultConfig()
+	c.Dirs = []string{"/dev"}
+	c.AllowPartial = true
+	c.SameFilesystem = true
+	var added []string
+	w, err := c.walk(func(path string) error {
+		added = append(added, path)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(added, "/dev/shm") {
+		t.Errorf("/dev/shm was watched")
+	}
+	if !slices.Contains(w.ignored, Ignored{Path: "/dev/shm"}) {
+		t.Errorf("expected /dev/shm in %v", w.ignored)
+	}
+}
@@ -1,9 +1,14 @@
 package watch
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"log/slog"
@@ -16,6 +21,88 @@ import (
 // then calls onchange. Send a value to `halt` to exit early and cancel the
 // watcher. Provide an optional logger.
 //
+// Watch is a shorthand for Config.Watch with no Ignore patterns; see there for
+// details.
+func Watch(dirs []string, debounce time.Duration, log *slog.Logger, onchange func() bool) (halt chan<- struct{}, err error) {
+	c := Config{
+		Dirs:     dirs,
+		Debounce: debounce,
+		Logger:   log,
+	}
+	if onchange != nil {
+		c.OnChange = func(context.Context, Cycle) bool { return onchange() }
+	}
+	// onchange was called once per debounce before transient and special
+	// files were dropped, so keep calling it when they are all that changed.
+	c.settle = true
+	return c.Watch()
+}
+
+// WatchOnce watches `dirs` until the first cycle settles, after `debounce`
+// passes with no events, then stops the watcher and returns the changes of
+// that cycle, e.g. for a build script that blocks until something changes.
+// It returns early with the error of ctx once it is done, or with an error
+// if the watcher fails.
+//
+// The watcher is configured as by DefaultConfig, then by each of opts in
+// order. Its OnChange is replaced, and its Handlers are dropped.
+func WatchOnce(ctx context.Context, dirs []string, debounce time.Duration, opts ...func(*Config)) (ChangeSet, error) {
+	c := DefaultConfig()
+	c.Dirs = dirs
+	c.Debounce = debounce
+	for _, opt := range opts {
+		opt(&c)
+	}
+	var changes ChangeSet
+	c.Handlers = nil
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		changes = cycle.Changes
+		return false
+	}
+	if err := c.Run(ctx); err != nil {
+		return ChangeSet{}, err
+	}
+	return changes, nil
+}
+
+// Until watches `dirs` until done returns true, and then stops the watcher
+// and returns nil. done is called with an empty ChangeSet once the watcher
+// is ready, so that a condition already true returns at once, and then with
+// the changes of each cycle, e.g. to return once build/done.flag exists:
+//
+//	err := watch.Until(ctx, []string{"build"}, 100*time.Millisecond, func(watch.ChangeSet) bool {
+//		_, err := os.Stat("build/done.flag")
+//		return err == nil
+//	})
+//
+// It returns early with the error of ctx once it is done, or with an error
+// if the watcher fails. The watcher is configured as for WatchOnce.
+func Until(ctx context.Context, dirs []string, debounce time.Duration, done func(ChangeSet) bool, opts ...func(*Config)) error {
+	c := DefaultConfig()
+	c.Dirs = dirs
+	c.Debounce = debounce
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.Handlers = nil
+	c.Initial = true
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		return !done(cycle.Changes)
+	}
+	return c.Run(ctx)
+}
+
+// Watch waits for changes to any of the directories in c.Dirs (recursively),
+// delays for c.Debounce duration until no changes occurr within the window,
+// and then calls c.OnChange. Send a value to `halt` or close it to exit early
+// and cancel the watcher. Sending again is safe until the watcher stopped, and
+// once more after. Where it may be halted any number of times, close halt
+// once or send with a select and a default case: a send can only block when
+// the watcher is already stopping.
+//
+// Watch returns once every directory is being watched, so it is safe to start
+// changing files as soon as it returns (or from c.OnReady).
+//
 // After the first change event arrives, wait for further events until
 // `debounce` delay passes with no events. This 'debounce' check tries to avoid
 // a burst of reloads if multiple files are changed in quick succession (e.g.
@@ -26,100 +113,910 @@ import (
 // watch/unwatch directories as their events are received. A result of this
 // design is that it may not be suited to watching thousands of directories, or
 // directories that change frequently.
-func Watch(dirs []string, debounce time.Duration, log *slog.Logger, onchange func() bool) (halt chan<- struct{}, err error) {
-	if len(dirs) == 0 {
-		err = fmt.Errorf("empty watchPaths")
+//
+// To let the EnvDirs, EnvDebounce and EnvIgnore environment variables
+// override c.Dirs, c.Debounce and c.Ignore, apply FromEnv to c first.
+//
+// Each debounce cycle gets a number when the first event arrives, unique among
+// the cycles of every watcher in the process, so that cycles that interleave
+// can be told apart. Log lines emitted during a cycle carry its number in the
+// "cycle" attribute.
+func (c Config) Watch() (halt chan<- struct{}, err error) {
+	w, err := c.Start()
+	if err != nil {
 		return
 	}
+	return w.halt, nil
+}
+
+// Watcher is a watcher started with Config.Start.
+type Watcher struct {
+	halt    chan struct{}
+	stopped chan struct{}
+	err     error
+	trigger *trigger
+}
+
+// Start is like Watch, but returns a Watcher to halt the watcher with and to
+// wait for it to stop.
+func (c Config) Start() (*Watcher, error) {
+	c.trigger = newTrigger()
+	loop, err := c.start()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{halt: make(chan struct{}, 1), stopped: make(chan struct{}), trigger: c.trigger}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// Keep taking halts until the loop stopped, so that repeated ones
+		// don't block.
+		for {
+			select {
+			case _, ok := <-w.halt:
+				cancel()
+				if !ok {
+					<-w.stopped
+					return
+				}
+			case <-w.stopped:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer close(w.stopped)
+		defer cancel()
+		w.err = loop(ctx)
+		if errors.Is(w.err, context.Canceled) {
+			w.err = ErrHalted
+		}
+	}()
+	return w, nil
+}
+
+// Halt stops the watcher, if it is not stopping already. It does not wait for
+// it to stop; see Wait.
+func (w *Watcher) Halt() {
+	select {
+	case w.halt <- struct{}{}:
+	default:
+	}
+}
+
+// Trigger runs a cycle as if a change to paths had settled, e.g. for a
+// "rebuild now" button: at once if no cycle is in progress, or ending the
+// one in progress early. The paths, which may be none, are neither ignored
+// nor filtered, and are sorted into the cycle's Changes like the paths of
+// write events. Trigger doesn't wait for the cycle: while OnChange is busy,
+// the triggers are merged into the next cycle. With Handlers, each of them
+// gets a cycle, and with Config.Share, every watcher that shares the loop.
+func (w *Watcher) Trigger(paths ...string) {
+	w.trigger.push(paths)
+}
+
+// Done returns a channel that is closed once the watcher stopped.
+func (w *Watcher) Done() <-chan struct{} { return w.stopped }
+
+// Wait blocks until the watcher stopped and returns why: ErrHalted if it was
+// halted, nil if OnChange returned false, or the error that stopped it, like
+// Run does.
+func (w *Watcher) Wait() error {
+	<-w.stopped
+	return w.err
+}
+
+// Run is like Watch, but blocks until the watcher stops and returns why: the
+// error of ctx once it is done, nil if c.OnChange returned false, or an error
+// if the event source failed. It is meant to be run in an errgroup.Group or
+// similar supervisor.
+func (c Config) Run(ctx context.Context) error {
+	loop, err := c.start()
+	if err != nil {
+		return err
+	}
+	return loop(ctx)
+}
+
+// start validates c and establishes the initial watch set. The returned loop
+// handles events until ctx is done, OnChange returns false, or the event
+// source fails.
+func (c Config) start() (loop func(ctx context.Context) error, err error) {
+	if err = c.Validate(); err != nil {
+		return
+	}
+	if len(c.Handlers) > 0 {
+		return c.startHandlers()
+	}
+	if key, ok := c.shareKey(); ok {
+		return c.join(key)
+	}
+	return c.startLoop()
+}
+
+// startHandlers starts a loop for OnChange and one for each of c.Handlers.
+// The returned loop runs them all until every one has stopped, or until the
+// first one fails, which stops the others. The loops share a single
+// fsnotify.Watcher of their own, or the one of the process with
+// Config.Share, so each directory is watched once.
+func (c Config) startHandlers() (func(ctx context.Context) error, error) {
+	configs := []Config{c}
+	configs[0].Handlers = nil
+	for _, h := range c.Handlers {
+		configs = append(configs, c.handler(h))
+	}
+	h := &hub{}
+	for i := range configs {
+		if !c.Share {
+			configs[i].hub = h
+		}
+		if i > 0 && c.trigger != nil {
+			configs[i].trigger = newTrigger()
+			c.trigger.link(configs[i].trigger)
+		}
+	}
+
+	var loops []func(ctx context.Context) error
+	for i, hc := range configs {
+		loop, err := hc.startLoop()
+		if err != nil {
+			// Running the loops with a done context closes their watchers.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			for _, loop := range loops {
+				loop(ctx)
+			}
+			if i > 0 {
+				err = fmt.Errorf("failed to start handler %d: %w", i-1, err)
+			}
+			return nil, err
+		}
+		loops = append(loops, loop)
+	}
+
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		errs := make(chan error, len(loops))
+		for _, loop := range loops {
+			go func(loop func(ctx context.Context) error) {
+				errs <- loop(ctx)
+			}(loop)
+		}
+		var first error
+		for range loops {
+			if err := <-errs; err != nil && first == nil {
+				first = err
+				cancel()
+			}
+		}
+		return first
+	}, nil
+}
+
+// startLoop is start for a valid Config without Handlers.
+func (c Config) startLoop() (loop func(ctx context.Context) error, err error) {
+	c.ignore = compileIgnore(c.Ignore)
+	c.listings = newListings()
+	log := c.Logger
 	if log == nil {
 		log = slog.Default()
 	}
 
-	startwatcher := func() (*fsnotify.Watcher, error) {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create new fsnotify watcher: %w", err)
+	interval := c.Poll
+	if interval == 0 {
+		interval = DefaultPoll
+	}
+	if c.NewSource == nil && c.FS == nil && c.Poll == 0 {
+		for _, root := range c.Dirs {
+			if onNinePMount(root) && !slices.Contains(c.PollDirs, root) {
+				log.Warn("root is on a 9p mount, where fsnotify misses changes from the host; polling it instead", "path", root, "interval", interval)
+				c.PollDirs = append(c.PollDirs[:len(c.PollDirs):len(c.PollDirs)], root)
+			}
+		}
+	}
+	notify := newFsnotifySource
+	if c.hub != nil {
+		notify = func() (Source, error) { return c.hub.view() }
+	} else if c.Share {
+		notify = newSharedSource
+	}
+	poll := func() (Source, error) { return NewPollWatcher(c.FS, interval), nil }
+	newsource, backend := c.NewSource, "custom"
+	var mixed *mixedSource // the latest source, if it polls some directories
+	pollUncovered := c.PollUncovered && c.MaxDirs > 0
+	if newsource == nil && (len(c.PollDirs) > 0 || pollUncovered) && c.FS == nil && fsnotifySupported {
+		newsource = func() (Source, error) {
+			watch, err := notify()
+			if err != nil {
+				return nil, err
+			}
+			mixed = newMixedSource(watch, NewPollWatcher(nil, interval), c.PollDirs)
+			return mixed, nil
+		}
+		backend = "fsnotify"
+	} else if newsource == nil && (c.Poll > 0 || c.FS != nil || !fsnotifySupported) {
+		newsource, backend = poll, "poll"
+	} else if newsource == nil {
+		newsource, backend = notify, "fsnotify"
+	}
+
+	raised := false // the system's limit on watches, at most once
+	var startwatcher func(log *slog.Logger) (*watchSet, error)
+	startwatcher = func(log *slog.Logger) (*watchSet, error) {
+		// Once fsnotify runs out of file descriptors, every directory is
+		// polled instead.
+		fallback := func() (*watchSet, error) {
+			newsource, backend = poll, "poll"
+			return startwatcher(log)
+		}
+		mixed = nil
+		watcher, err := newsource()
+		if backend == "fsnotify" && c.checkDescriptors(log, 0, err, nil) {
+			return fallback()
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to create new watcher: %w", err)
+		}
+		if len(c.Middleware) > 0 {
+			watcher = newMiddlewareSource(watcher, c.Middleware)
 		}
 
 		// Watch every directory under watchPaths, recursively, as recommended by `watcher.Add` docs.
 		count := 0
-		for _, path := range dirs {
-			err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
-				if err != nil {
-					return err
-				}
-				if d.IsDir() {
-					err = watcher.Add(path)
-					count += 1
-				}
+		walked, err := c.walk(func(path string) error {
+			if err := watcher.Add(path); err != nil {
 				return err
-			})
-			if err != nil {
+			}
+			count += 1
+			return nil
+		}, nil)
+		if backend == "fsnotify" && c.checkWatchLimit(log, count, err, walked.failed, !raised) {
+			raised = true
+			if err != nil || len(walked.failed) > 0 {
 				watcher.Close()
-				return nil, fmt.Errorf("failed scanning for directories: %w", err)
+				return startwatcher(log)
+			}
+		}
+		if backend == "fsnotify" && c.checkDescriptors(log, count, err, walked.failed) {
+			watcher.Close()
+			return fallback()
+		}
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		c.listings.prune()
+		log.Debug("found directories to watch", "count", count, "rootdirs", c.Dirs)
+		if len(walked.uncovered) > 0 && pollUncovered && mixed != nil {
+			log.Warn("reached MaxDirs, polling the remaining directories", "max", c.MaxDirs, "uncovered", walked.uncovered, "interval", interval)
+			if err := c.pollUncovered(watcher, mixed, &walked); err != nil {
+				watcher.Close()
+				return nil, err
+			}
+		} else if len(walked.uncovered) > 0 {
+			log.Warn("reached MaxDirs, some directories are not watched", "max", c.MaxDirs, "uncovered", walked.uncovered)
+		}
+		for _, err := range walked.failed {
+			log.Warn("failed to watch directory", "path", err.Path, "error", err.Err)
+		}
+		for i := range walked.roots {
+			walked.roots[i].Backend = backend
+			if c.NewSource == nil && slices.Contains(c.PollDirs, walked.roots[i].Path) {
+				walked.roots[i].Backend = "poll"
 			}
 		}
-		log.Debug("found directories to watch", "count", count, "rootdirs", dirs)
-		return watcher, nil
+		return &watchSet{Source: watcher, walked: walked, dirs: count}, nil
 	}
 
-	watcher, err := startwatcher()
+	watcher, err := startwatcher(log)
 	if err != nil {
 		return
 	}
+	offline := false
+	if c.Manifest != "" {
+		offline, err = c.changedOffline()
+		if err != nil {
+			c.report(log, StateError, 0, "failed to check manifest for offline changes", err)
+			err = nil
+		}
+	}
 
-	halt_ := make(chan struct{}, 1)
+	var cache *texts
+	if c.DiffSize > 0 {
+		if cache, err = c.loadTexts(); err != nil {
+			watcher.Close()
+			return
+		}
+	}
 
-	go func() {
+	if c.Tree != nil {
+		if err = c.Tree.build(c); err != nil {
+			watcher.Close()
+			return
+		}
+	}
+
+	if c.OnReady != nil {
+		c.OnReady(watcher.coverage())
+	}
+
+	loop = func(ctx context.Context) (err error) {
 		var timer *time.Timer
+		var cycle uint64
+		var ev fsnotify.Event
+		var snap map[string]fileState
+		var stated map[string]statResult // of the paths of the settled cycle
+		var ok bool
+		var info Cycle
+		var first time.Time // of the current cycle
+		changed := map[string]fsnotify.Op{}
+		renames := map[string]string{}      // new path -> old path
+		var from string                     // path of the previous event, if renamed
+		born := map[string]bool{}           // paths first seen created in the cycle
+		touched := map[string]fsnotify.Op{} // directory changes for c.Incremental
+		overflowed := false                 // events were lost since the last rebuild
+		var paths []string
+		clog := log
+
+		own := c.ownFiles()
+
+		// With c.FilterWorkers, events are matched against c.Filter on a pool
+		// and come back on filtered; pending counts those not back yet.
+		var pool *filterPool
+		var filtered <-chan filterResult
+		pending := 0
+		if c.Filter != nil && c.FilterWorkers > 0 {
+			pool = newFilterPool(c.Filter, c.FilterWorkers)
+			defer pool.Close()
+			filtered = pool.results
+		}
+
+		// triggered is nil, and never ready, unless the loop was started by
+		// Config.Start.
+		var triggered <-chan struct{}
+		if c.trigger != nil {
+			triggered = c.trigger.notify
+		}
+
+		var reconcile <-chan time.Time
+		if c.Reconcile > 0 {
+			ticker := time.NewTicker(c.Reconcile)
+			defer ticker.Stop()
+			reconcile = ticker.C
+		}
+
+		// rebuild replaces the watch set with a fresh walk of c.Dirs, or keeps
+		// it if the walk fails. It returns an error only if c.RescanRetries
+		// are exhausted, ctx is done while waiting to retry, or the roots were
+		// removed with c.HaltOnRemove.
+		rebuild := func(periodic bool) error {
+			if c.HaltOnRemove && c.rootsRemoved() {
+				clog.Info("all roots were removed")
+				return ErrRootsRemoved
+			}
+			previous := watcher.dirs
+			if c.Incremental && !periodic && !overflowed {
+				start := time.Now()
+				err := watcher.patch(c, touched)
+				clear(touched)
+				if err == nil {
+					clog.Debug("patched watcher")
+					if c.OnRescan != nil {
+						c.OnRescan(Rescan{Cycle: cycle, Incremental: true, Duration: time.Since(start), Previous: previous, Coverage: watcher.coverage()})
+					}
+					return nil
+				}
+				clog.Debug("failed to patch watcher, rebuilding it", "reason", err)
+			}
+			clear(touched)
+			overflowed = false
+
+			start := time.Now()
+			backoff := c.RescanBackoff
+			if backoff == 0 {
+				backoff = DefaultRescanBackoff
+			}
+			newwatcher, err := startwatcher(clog)
+			for retry := 0; err != nil && retry < c.RescanRetries; retry++ {
+				c.report(clog, RescanError, cycle, "failed to start new watcher", err)
+				clog.Debug("retrying to start new watcher", "delay", backoff)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				backoff = min(backoff*2, maxRescanBackoff)
+				newwatcher, err = startwatcher(clog)
+			}
+			rescan := Rescan{Cycle: cycle, Reconcile: periodic, Duration: time.Since(start), Previous: previous, Err: err}
+			if err != nil {
+				c.report(clog, RescanError, cycle, "failed to start new watcher", err)
+			} else {
+				if err := watcher.Close(); err != nil {
+					c.report(clog, SourceError, cycle, "error while stopping watcher", err)
+				}
+				clog.Debug("starting new watcher")
+				watcher = newwatcher
+				rescan.Coverage = watcher.coverage()
+			}
+			if c.OnRescan != nil {
+				c.OnRescan(rescan)
+			}
+			if err != nil && c.RescanRetries > 0 {
+				return fmt.Errorf("failed to rebuild watch set after %d retries: %w", c.RescanRetries, err)
+			}
+			return nil
+		}
+
+		// restart replaces the failed source with a fresh walk of c.Dirs,
+		// waiting before each of c.Restarts attempts. It returns the error of
+		// the last attempt once they are exhausted, or that of ctx.
+		restart := func() error {
+			if c.Restarts == 0 {
+				return errSourceClosed
+			}
+			c.report(clog, SourceError, cycle, "watcher failed", errSourceClosed)
+			watcher.Close() // already failed
+			backoff := c.RestartBackoff
+			if backoff == 0 {
+				backoff = DefaultRestartBackoff
+			}
+			var err error
+			for attempt := 1; attempt <= c.Restarts; attempt++ {
+				clog.Info("restarting watcher", "attempt", attempt, "delay", backoff)
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				var newwatcher *watchSet
+				newwatcher, err = startwatcher(clog)
+				if c.OnRestart != nil {
+					c.OnRestart(Restart{Cycle: cycle, Attempt: attempt, Delay: backoff, Err: err})
+				}
+				if err == nil {
+					watcher = newwatcher
+					return nil
+				}
+				c.report(clog, SourceError, cycle, "failed to restart watcher", err)
+				backoff = min(backoff*2, maxRescanBackoff)
+			}
+			return fmt.Errorf("failed to restart watcher after %d attempts: %w", c.Restarts, err)
+		}
+
+		// record adds ev to the cycle. A rename immediately followed by a
+		// create is taken to be a single move, as fsnotify reports them.
+		record := func(ev fsnotify.Event) {
+			if changed[ev.Name] == 0 && ev.Has(fsnotify.Create) {
+				born[ev.Name] = true
+			}
+			changed[ev.Name] |= ev.Op
+			if from != "" && ev.Has(fsnotify.Create) {
+				renames[ev.Name] = from
+			}
+			from = ""
+			if ev.Has(fsnotify.Rename) {
+				from = ev.Name
+			}
+		}
+
+		// trace takes attributes rather than key-value pairs, so that events
+		// are not boxed into interfaces when tracing is off.
+		trace := func(ev fsnotify.Event, action string, attrs ...slog.Attr) {
+			if c.Trace {
+				attrs = append([]slog.Attr{slog.String("path", ev.Name), slog.Any("op", ev.Op), slog.Time("time", time.Now()), slog.String("action", action)}, attrs...)
+				clog.LogAttrs(ctx, slog.LevelDebug, "event", attrs...)
+			}
+		}
+
+		// resolve maps events on symlink targets back to the links.
+		resolve := func(ev *fsnotify.Event) bool {
+			name, ok := watcher.links.resolve(ev.Name)
+			if !ok {
+				trace(*ev, "ignored", slog.String("reason", "next to a linked file"))
+				return false
+			}
+			ev.Name = name
+			return true
+		}
+
+		// accept runs ev through the steps every event goes through, and
+		// reports whether it is part of the cycle. Events sent to pool are
+		// not, until they come back on filtered.
+		accept := func(ev *fsnotify.Event) bool {
+			ev.Name = normPath(watcher.short(ev.Name))
+			if !watcher.keep(ev.Name) {
+				trace(*ev, "ignored", slog.String("reason", "next to a root file"))
+				return false
+			}
+			if !resolve(ev) {
+				return false
+			}
+			if own.has(ev.Name) {
+				trace(*ev, "ignored", slog.String("reason", "written by the watcher"))
+				return false
+			}
+			if pattern := c.ignoredBy(ev.Name); pattern != "" {
+				trace(*ev, "ignored", slog.String("pattern", pattern))
+				return false
+			}
+			if c.Incremental && ev.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+				touched[ev.Name] |= ev.Op
+			}
+			if c.IgnoreMetadata && ev.Op == fsnotify.Chmod {
+				trace(*ev, "ignored", slog.String("reason", "metadata only"))
+				return false
+			}
+			if pool != nil {
+				pool.submit(*ev)
+				pending += 1
+				return false
+			}
+			if c.Filter != nil && !c.Filter.Match(ev.Name) {
+				trace(*ev, "filtered", slog.Any("filter", c.Filter))
+				return false
+			}
+			return true
+		}
+
+		// sourceFailed reports err from the source, or restarts the source if
+		// its channel was closed, as ok is false. It returns an error only if
+		// the watcher must halt.
+		sourceFailed := func(err error, ok bool) error {
+			if !ok {
+				return restart()
+			}
+			kind := SourceError
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				kind, overflowed = OverflowError, true
+			}
+			c.report(clog, kind, cycle, "watcher error", err)
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			goto halt
+		}
+
+		if c.InitialScan {
+			err = c.walkFiles(func(path string, d fs.DirEntry) error {
+				path = normPath(path)
+				if c.Filter == nil || c.Filter.Match(path) {
+					changed[path] = fsnotify.Create
+				}
+				return nil
+			})
+			if err != nil {
+				err = fmt.Errorf("failed to scan files: %w", err)
+				goto halt
+			}
+		}
+
+		if offline || c.Initial || c.InitialScan {
+			first = time.Now()
+			cycle = nextCycle()
+			clog = log.With("cycle", cycle)
+			if offline {
+				clog.Info("files changed while not watching")
+			} else {
+				clog.Debug("initial run")
+			}
+			goto settled
+		}
 
 	begin:
 		select {
-		case <-watcher.Events:
-		case <-halt_:
+		case <-triggered:
+			first = time.Now()
+			cycle = nextCycle()
+			clog = log.With("cycle", cycle)
+			for _, path := range c.trigger.take() {
+				record(fsnotify.Event{Name: normPath(path), Op: fsnotify.Write})
+			}
+			clog.Debug("cycle triggered")
+			goto settled
+		case ev, ok = <-watcher.Events():
+			if !ok {
+				if err = restart(); err != nil {
+					goto halt
+				}
+				goto begin
+			}
+			if !accept(&ev) {
+				goto begin
+			}
+		case err, ok = <-watcher.Errors():
+			if err = sourceFailed(err, ok); err != nil {
+				goto halt
+			}
+			goto begin
+		case r := <-filtered:
+			pending -= 1
+			if ev = r.ev; !r.match {
+				trace(ev, "filtered", slog.Any("filter", c.Filter))
+				goto begin
+			}
+		case <-reconcile:
+			clog.Debug("reconciling watch set")
+			if err = rebuild(true); err != nil {
+				goto halt
+			}
+			goto begin
+		case <-ctx.Done():
+			err = ctx.Err()
 			goto halt
 		}
-		timer = time.NewTimer(debounce)
-		log.Debug("event received, debouncing", "duration", debounce)
+		// Every log line from the first event until the watcher is rebuilt is
+		// tagged with the cycle id, so interleaved cycles can be told apart.
+		first = time.Now()
+		cycle = nextCycle()
+		clog = log.With("cycle", cycle)
+		trace(ev, "cycle started")
+		record(ev)
+		timer = time.NewTimer(c.Debounce)
+		clog.Debug("event received, debouncing", "duration", c.Debounce)
 
 	debounce:
 		select {
-		case <-watcher.Events:
+		case <-triggered:
+			for _, path := range c.trigger.take() {
+				record(fsnotify.Event{Name: normPath(path), Op: fsnotify.Write})
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			clog.Debug("cycle triggered, ending debounce")
+			goto settled
+		case ev, ok = <-watcher.Events():
+			if !ok {
+				if err = restart(); err != nil {
+					goto halt
+				}
+				goto debounce
+			}
+			if !accept(&ev) {
+				goto debounce
+			}
+			trace(ev, "debounced")
+			record(ev)
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.Debounce)
+			goto debounce
+		case err, ok = <-watcher.Errors():
+			if err = sourceFailed(err, ok); err != nil {
+				goto halt
+			}
+			goto debounce
+		case r := <-filtered:
+			pending -= 1
+			if ev = r.ev; !r.match {
+				trace(ev, "filtered", slog.Any("filter", c.Filter))
+				goto debounce
+			}
+			trace(ev, "debounced")
+			record(ev)
 			if !timer.Stop() {
 				<-timer.C
 			}
-			timer.Reset(debounce)
+			timer.Reset(c.Debounce)
 			goto debounce
-		case <-halt_:
+		case <-ctx.Done():
+			err = ctx.Err()
 			goto halt
 		case <-timer.C:
-			// only fall through if the timer expires first
+			// only fall through if the timer expires first, and no event
+			// is still being filtered
+			if pending > 0 {
+				timer.Reset(c.Debounce)
+				goto debounce
+			}
 		}
 
-		if ok := onchange(); !ok {
+	settled:
+		// Drop the paths that were created and removed again during the cycle,
+		// like temporary files, and FIFOs, sockets and devices, whose content
+		// is never read, and skip the cycle if nothing else changed. The
+		// stats are kept for changeSet.
+		ok = len(changed) == 0
+		stated = make(map[string]statResult, len(changed))
+		for path := range changed {
+			info, err := c.stat(path)
+			if born[path] && errors.Is(err, fs.ErrNotExist) {
+				delete(changed, path)
+			} else if err == nil && info.Mode()&specialMode != 0 {
+				clog.Debug("special file changed, dropping it", "path", path)
+				delete(changed, path)
+			} else {
+				stated[path] = statResult{info, err}
+			}
+		}
+		clear(born)
+		if !ok && len(changed) == 0 && !c.settle {
+			clog.Debug("only transient or special files changed, skipping onchange")
+			clear(renames)
+			from = ""
+			if err = rebuild(false); err != nil {
+				goto halt
+			}
+			goto begin
+		}
+
+		snap = nil
+		if c.Manifest != "" {
+			var err error
+			if snap, err = c.snapshot(); err != nil {
+				c.report(clog, StateError, cycle, "failed to snapshot files for manifest", err)
+			}
+		}
+
+		paths = make([]string, 0, len(changed))
+		for path := range changed {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+		info = Cycle{ID: cycle, Start: first, Time: time.Now(), Paths: paths}
+		if c.Stat {
+			info.Stats = make(map[string]Stat, len(paths))
+		}
+		info.Changes = c.changeSet(paths, changed, renames, stated, info.Stats)
+		stated = nil
+		clear(changed)
+		clear(renames)
+		from = ""
+		if cache != nil {
+			info.Diffs = cache.update(paths)
+		}
+		if c.Tree != nil {
+			if err := c.Tree.update(c, paths); err != nil {
+				c.report(clog, StateError, cycle, "failed to update tree", err)
+			}
+		}
+
+		if c.Journal != "" {
+			if err := appendJournal(c.Journal, info); err != nil {
+				c.report(clog, StateError, cycle, "failed to append to journal", err)
+			}
+		}
+
+		clog.Debug("debounce settled, calling onchange")
+		ok = c.onchange(ctx, clog, info)
+		if c.Latency != nil {
+			c.Latency.observe(info.Time.Sub(info.Start), time.Since(info.Time), len(paths) > 0)
+		}
+
+		if snap != nil {
+			if err := writeManifest(c.Manifest, snap); err != nil {
+				c.report(clog, StateError, cycle, "failed to save manifest", err)
+			}
+		}
+		if !ok {
 			goto halt
 		}
 
 		// try to rebuild watcher since there could be new subdirs.
-		{
-			newwatcher, err := startwatcher()
-			if err != nil {
-				log.Info("failed to start new fsnotify watcher", "error", err)
-			} else {
-				err = watcher.Close()
-				if err != nil {
-					log.Info("error while stopping fsnotify watcher", "error", err)
-				}
-				log.Debug("starting new fsnotify watcher")
-				watcher = newwatcher
-			}
+		if err = rebuild(false); err != nil {
+			goto halt
 		}
 		goto begin
 
 	halt:
+		if timer != nil {
+			timer.Stop()
+		}
 		watcher.Close()
-		log.Debug("watcher stopped")
-	}()
+		log.Debug("watcher stopped", "error", err)
+		return err
+	}
+	return loop, nil
+}
+
+// lastCycle is the ID of the latest cycle of any watcher in the process.
+var lastCycle atomic.Uint64
+
+// nextCycle returns the ID of a new cycle.
+func nextCycle() uint64 { return lastCycle.Add(1) }
 
-	return halt_, nil
+// ownFiles are the files the watcher writes itself, by their cleaned and
+// absolute paths, so that their events don't start cycles of their own.
+type ownFiles map[string]bool
+
+// ownFiles returns the files written by a watcher for c: c.Journal, and
+// c.Manifest along with the temporary file it is written to.
+func (c Config) ownFiles() ownFiles {
+	own := ownFiles{}
+	paths := []string{c.Journal}
+	if c.Manifest != "" {
+		paths = append(paths, c.Manifest, c.Manifest+".tmp")
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		own[normPath(filepath.Clean(path))] = true
+		if abs, err := filepath.Abs(path); err == nil {
+			own[normPath(abs)] = true
+		}
+	}
+	return own
+}
+
+// has reports whether the event path is one of own.
+func (own ownFiles) has(path string) bool {
+	if len(own) == 0 {
+		return false
+	}
+	if own[path] {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && own[normPath(abs)]
 }
+
+// onchange calls c.OnChange, bounded by c.Timeout. A call that times out
+// counts as returning true, so the watcher goes on. With c.OnPanic, a call
+// that panics returns what OnPanic does.
+func (c Config) onchange(ctx context.Context, log *slog.Logger, info Cycle) bool {
+	call := func(ctx context.Context) (ok bool) {
+		if c.OnPanic != nil {
+			defer func() {
+				if v := recover(); v != nil {
+					stack := debug.Stack()
+					c.report(log, PanicError, info.ID, "onchange panicked", fmt.Errorf("panic: %v", v))
+					ok = c.OnPanic(v, stack)
+				}
+			}()
+		}
+		return c.OnChange(ctx, info)
+	}
+	if c.Timeout <= 0 {
+		return call(ctx)
+	}
+	ctx_, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	done := make(chan bool, 1)
+	go func() { done <- call(ctx_) }()
+	select {
+	case ok := <-done:
+		return ok
+	case <-ctx_.Done():
+		if ctx.Err() == nil {
+			c.report(log, TimeoutError, info.ID, "onchange timed out", ctx_.Err())
+		}
+		return true
+	}
+}
+
+// report logs err at info level with msg and passes it to OnError.
+func (c Config) report(log *slog.Logger, kind ErrorKind, cycle uint64, msg string, err error) {
+	log.Info(msg, "error", err)
+	if c.OnError != nil {
+		c.OnError(&Error{Kind: kind, Cycle: cycle, Err: err})
+	}
+}
+
+// ErrHalted is returned by Watcher.Wait when the watcher was halted.
+var ErrHalted = errors.New("watcher halted")
+
+// ErrRootsRemoved is returned by Run when every one of Config.Dirs was
+// removed, with Config.HaltOnRemove.
+var ErrRootsRemoved = errors.New("all roots were removed")
+
+// rootsRemoved reports whether none of c.Dirs exists anymore.
+func (c Config) rootsRemoved() bool {
+	if len(c.Dirs) == 0 {
+		return false
+	}
+	for _, root := range c.Dirs {
+		if _, err := c.stat(root); !errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+	}
+	return true
+}
+
+// errSourceClosed is returned by Run when the event source closes its
+// channels while the watcher is running.
+var errSourceClosed = errors.New("event source closed unexpectedly")
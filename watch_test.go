@@ -1,10 +1,17 @@
 package watch
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 func TestWatchDirs(t *testing.T) {
@@ -141,3 +148,818 @@ func TestWatchDirs(t *testing.T) {
 		time.Sleep(2 * unit)
 	}
 }
+
+// fakeSource is a Source fed by the test through a shared channel.
+type fakeSource struct {
+	events chan fsnotify.Event
+}
+
+func (s fakeSource) Add(path string) error         { return nil }
+func (s fakeSource) Events() <-chan fsnotify.Event { return s.events }
+func (s fakeSource) Errors() <-chan error          { return nil }
+func (s fakeSource) Close() error                  { return nil }
+
+func TestWatchFakeSource(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle)
+
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 20 * time.Millisecond
+	c.Ignore = append(c.Ignore, "*.tmp")
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	ready := false
+	c.OnReady = func(Coverage) { ready = true }
+	rescans := make(chan Rescan, 1)
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	defer func() { halt <- struct{}{} }()
+	if !ready {
+		t.Errorf("OnReady was not called before Watch returned")
+	}
+
+	// A burst of events is coalesced into a single cycle.
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		events <- fsnotify.Event{Name: name, Op: fsnotify.Write}
+	}
+	first := <-cycles
+	if !slices.Equal(first.Paths, []string{"a.txt", "b.txt", "c.txt"}) {
+		t.Errorf("expected a cycle with 3 paths, got %+v", first)
+	}
+	if r := <-rescans; r.Cycle != first.ID || r.Dirs != 1 || r.Err != nil {
+		t.Errorf("unexpected rescan %+v", r)
+	}
+
+	// Ignored events never start a cycle.
+	events <- fsnotify.Event{Name: "x.tmp", Op: fsnotify.Create}
+	select {
+	case cycle := <-cycles:
+		t.Errorf("ignored event started cycle %d", cycle.ID)
+	case <-time.After(5 * c.Debounce):
+	}
+
+	// The rescan reports the growth of the tree.
+	if err := os.Mkdir(filepath.Join(c.Dirs[0], "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	events <- fsnotify.Event{Name: filepath.Join(c.Dirs[0], "d"), Op: fsnotify.Create}
+	if cycle := <-cycles; cycle.ID <= first.ID {
+		t.Errorf("expected a cycle after %d, got %d", first.ID, cycle.ID)
+	}
+	if r := <-rescans; r.Previous != 1 || r.Dirs != 2 || r.Duration <= 0 {
+		t.Errorf("unexpected rescan %+v", r)
+	}
+}
+
+func TestRun(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(context.Context, Cycle) bool { return false }
+
+	run := func(ctx context.Context) <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- c.Run(ctx) }()
+		return done
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := run(ctx)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled after cancel, got %v", err)
+	}
+
+	done = run(context.Background())
+	events <- fsnotify.Event{Name: "a"}
+	if err := <-done; err != nil {
+		t.Errorf("expected nil after OnChange returned false, got %v", err)
+	}
+
+	done = run(context.Background())
+	close(events)
+	if err := <-done; err == nil {
+		t.Errorf("expected an error after the source closed")
+	}
+
+	c.Dirs = nil
+	if err := c.Run(context.Background()); err == nil {
+		t.Errorf("expected an error for an invalid config")
+	}
+}
+
+func TestWatchInitial(t *testing.T) {
+	cycles := make(chan Cycle)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Initial = true
+	c.NewSource = func() (Source, error) { return fakeSource{}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return false
+	}
+	if _, err := c.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cycle := <-cycles:
+		if cycle.ID == 0 || len(cycle.Paths) != 0 {
+			t.Errorf("unexpected initial cycle %+v", cycle)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("OnChange was not called at startup")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	dir := t.TempDir()
+	all, css := make(chan Cycle, 10), make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = 10 * time.Millisecond
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		all <- cycle
+		return true
+	}
+	c.Handlers = []Handler{{
+		Debounce: 50 * time.Millisecond,
+		Ignore:   []string{"*.go"},
+		OnChange: func(_ context.Context, cycle Cycle) bool {
+			css <- cycle
+			return true
+		},
+	}}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	if err := os.WriteFile(dir+"/main.go", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/site.css", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := func(cycles <-chan Cycle, want string) {
+		t.Helper()
+		for {
+			select {
+			case cycle := <-cycles:
+				for _, path := range cycle.Paths {
+					if path == dir+"/main.go" && want != path {
+						t.Errorf("handler got ignored path %s", path)
+					}
+					if path == want {
+						return
+					}
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%s was not seen", want)
+				return
+			}
+		}
+	}
+	seen(all, dir+"/main.go")
+	seen(css, dir+"/site.css")
+
+	// The handlers share a watcher of their own, not the one of Config.Share.
+	shared.mu.Lock()
+	refs := shared.refs[dir]
+	shared.mu.Unlock()
+	if refs != 0 {
+		t.Errorf("%s is in %d views of the watcher of Config.Share, want 0", dir, refs)
+	}
+}
+
+// errorSource is a fakeSource that also reports errors fed by the test.
+type errorSource struct {
+	fakeSource
+	errors chan error
+}
+
+func (s errorSource) Errors() <-chan error { return s.errors }
+
+func TestOnError(t *testing.T) {
+	errs := make(chan error)
+	reported := make(chan error)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.NewSource = func() (Source, error) { return errorSource{errors: errs}, nil }
+	c.OnChange = func(context.Context, Cycle) bool { return true }
+	c.OnError = func(err error) { reported <- err }
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	for _, want := range []ErrorKind{OverflowError, SourceError} {
+		sent := fsnotify.ErrEventOverflow
+		if want == SourceError {
+			sent = os.ErrPermission
+		}
+		errs <- sent
+		var werr *Error
+		if err := <-reported; !errors.As(err, &werr) || werr.Kind != want || !errors.Is(err, sent) {
+			t.Errorf("expected a %v error wrapping %v, got %v", want, sent, err)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	rescans := make(chan Rescan, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Reconcile = 10 * time.Millisecond
+	c.NewSource = func() (Source, error) { return fakeSource{}, nil }
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(context.Context, Cycle) bool { return true }
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	// The new directory is found without any event.
+	if err := os.Mkdir(filepath.Join(c.Dirs[0], "new"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case r := <-rescans:
+			if !r.Reconcile || r.Cycle != 0 {
+				t.Fatalf("unexpected rescan %+v", r)
+			}
+			if r.Dirs == 2 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the new directory was not found")
+		}
+	}
+}
+
+func TestRescanRetries(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	var mu sync.Mutex
+	failures := 0 // of the next calls to NewSource
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.RescanRetries = 2
+	c.RescanBackoff = time.Millisecond
+	c.NewSource = func() (Source, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures -= 1
+			return nil, os.ErrPermission
+		}
+		return fakeSource{events}, nil
+	}
+	rescans := make(chan Rescan, 1)
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(context.Context, Cycle) bool { return true }
+	ready := make(chan struct{})
+	c.OnReady = func(Coverage) { close(ready) }
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(context.Background()) }()
+	<-ready
+
+	// The rebuild succeeds on the last retry.
+	mu.Lock()
+	failures = 2
+	mu.Unlock()
+	events <- fsnotify.Event{Name: "a"}
+	if r := <-rescans; r.Err != nil || r.Dirs != 1 {
+		t.Errorf("expected the rebuild to succeed, got %+v", r)
+	}
+
+	// Once retries are exhausted, the watcher stops with the error.
+	mu.Lock()
+	failures = 3
+	mu.Unlock()
+	events <- fsnotify.Event{Name: "b"}
+	if r := <-rescans; r.Err == nil {
+		t.Errorf("expected the rebuild to fail, got %+v", r)
+	}
+	if err := <-errs; !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected Run to return the rebuild error, got %v", err)
+	}
+}
+
+func TestHaltOnRemove(t *testing.T) {
+	ws := filepath.Join(t.TempDir(), "ws")
+	if err := os.MkdirAll(filepath.Join(ws, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := DefaultConfig()
+	c.Dirs = []string{ws}
+	c.Debounce = 20 * time.Millisecond
+	c.HaltOnRemove = true
+	c.OnChange = func(context.Context, Cycle) bool { return true }
+	ready := make(chan struct{})
+	c.OnReady = func(Coverage) { close(ready) }
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(context.Background()) }()
+	<-ready
+
+	if err := os.RemoveAll(ws); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err != ErrRootsRemoved {
+			t.Errorf("expected ErrRootsRemoved, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the watcher did not stop")
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "b", "c"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cycles := make(chan Cycle, 10)
+	rescans := make(chan Rescan, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{root}
+	c.Debounce = 20 * time.Millisecond
+	c.Incremental = true
+	c.OnRescan = func(r Rescan) { rescans <- r }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	step := func(op func() error, dirs int) Cycle {
+		t.Helper()
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+		var cycle Cycle
+		select {
+		case cycle = <-cycles:
+		case <-time.After(time.Second):
+			t.Fatal("no cycle")
+		}
+		if r := <-rescans; !r.Incremental || r.Dirs != dirs || r.Err != nil {
+			t.Errorf("expected an incremental rescan with %d dirs, got %+v", dirs, r)
+		}
+		return cycle
+	}
+
+	z := filepath.Join(root, "z")
+	step(func() error { return os.Rename(filepath.Join(root, "a"), z) }, 4)
+	// Events in the moved tree are reported with its new path.
+	f := filepath.Join(z, "b", "c", "f")
+	if cycle := step(func() error { return os.WriteFile(f, nil, 0o644) }, 4); !slices.Equal(cycle.Paths, []string{f}) {
+		t.Errorf("expected %s, got %v", f, cycle.Paths)
+	}
+	step(func() error { return os.MkdirAll(filepath.Join(root, "new", "dir"), 0o755) }, 6)
+	step(func() error { return os.RemoveAll(z) }, 3)
+}
+
+func TestTimeout(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	errs := make(chan error, 1)
+	cycles := make(chan Cycle, 1)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.Timeout = 10 * time.Millisecond
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnError = func(err error) { errs <- err }
+	c.OnChange = func(ctx context.Context, cycle Cycle) bool {
+		if slices.Equal(cycle.Paths, []string{"a"}) {
+			select {} // hung, ignoring ctx
+		}
+		cycles <- cycle
+		return false
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	events <- fsnotify.Event{Name: "a"}
+	var werr *Error
+	if err := <-errs; !errors.As(err, &werr) || werr.Kind != TimeoutError || werr.Cycle == 0 {
+		t.Errorf("expected a timeout error for the first cycle, got %v", err)
+	}
+	events <- fsnotify.Event{Name: "b"}
+	if cycle := <-cycles; cycle.ID <= werr.Cycle {
+		t.Errorf("expected a cycle after %d after the timeout, got %d", werr.Cycle, cycle.ID)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	panics := make(chan any, 1)
+	cycles := make(chan Cycle, 1)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnPanic = func(v any, stack []byte) bool {
+		if len(stack) == 0 {
+			t.Errorf("expected a stack trace")
+		}
+		panics <- v
+		return true
+	}
+	c.OnChange = func(ctx context.Context, cycle Cycle) bool {
+		if slices.Equal(cycle.Paths, []string{"a"}) {
+			panic("boom")
+		}
+		cycles <- cycle
+		return false
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	events <- fsnotify.Event{Name: "a"}
+	if v := <-panics; v != "boom" {
+		t.Errorf("expected boom, got %v", v)
+	}
+	events <- fsnotify.Event{Name: "b"}
+	if cycle := <-cycles; !slices.Equal(cycle.Paths, []string{"b"}) {
+		t.Errorf("expected the cycle of b after the panic, got %+v", cycle)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+type closingSource struct {
+	fakeSource
+	closed chan struct{}
+}
+
+func (s closingSource) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestHalt(t *testing.T) {
+	for _, name := range []string{"send", "close"} {
+		t.Run(name, func(t *testing.T) {
+			closed := make(chan struct{})
+			c := DefaultConfig()
+			c.Dirs = []string{t.TempDir()}
+			c.NewSource = func() (Source, error) {
+				return closingSource{fakeSource{make(chan fsnotify.Event)}, closed}, nil
+			}
+			c.OnChange = func(context.Context, Cycle) bool { return true }
+			halt, err := c.Watch()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name == "send" {
+				halt <- struct{}{}
+				halt <- struct{}{}
+			} else {
+				close(halt)
+			}
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatal("the watcher did not stop")
+			}
+			if name == "send" {
+				select {
+				case halt <- struct{}{}:
+				default:
+				}
+			}
+		})
+	}
+}
+
+func TestWatcherWait(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(context.Context, Cycle) bool { return false }
+
+	w, err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Halt()
+	w.Halt()
+	if err := w.Wait(); err != ErrHalted {
+		t.Errorf("expected ErrHalted after Halt, got %v", err)
+	}
+
+	if w, err = c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	events <- fsnotify.Event{Name: "a"}
+	<-w.Done()
+	if err := w.Wait(); err != nil {
+		t.Errorf("expected nil after OnChange returned false, got %v", err)
+	}
+
+	if w, err = c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	close(events)
+	if err := w.Wait(); err == nil || err == ErrHalted {
+		t.Errorf("expected the error of the source, got %v", err)
+	}
+}
+
+func TestRestarts(t *testing.T) {
+	sources := make(chan chan fsnotify.Event, 10)
+	fail := false
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 0
+	c.Restarts = 2
+	c.RestartBackoff = time.Millisecond
+	c.NewSource = func() (Source, error) {
+		if fail {
+			return nil, errors.New("no source")
+		}
+		events := make(chan fsnotify.Event)
+		sources <- events
+		return fakeSource{events}, nil
+	}
+	restarts := make(chan Restart, 10)
+	c.OnRestart = func(r Restart) { restarts <- r }
+	cycles := make(chan Cycle, 10)
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	c.OnRescan = func(Rescan) {}
+
+	w, err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(<-sources)
+	if r := <-restarts; r.Attempt != 1 || r.Err != nil {
+		t.Errorf("expected a successful first attempt, got %+v", r)
+	}
+	events := <-sources
+	events <- fsnotify.Event{Name: "a", Op: fsnotify.Write}
+	if cycle := <-cycles; !slices.Equal(cycle.Paths, []string{"a"}) {
+		t.Errorf("expected a cycle for a after the restart, got %+v", cycle)
+	}
+	events = <-sources // of the rebuild after the cycle
+
+	fail = true
+	close(events)
+	for attempt := 1; attempt <= 2; attempt++ {
+		if r := <-restarts; r.Attempt != attempt || r.Err == nil || r.Delay != time.Duration(attempt)*time.Millisecond {
+			t.Errorf("expected failed attempt %d, got %+v", attempt, r)
+		}
+	}
+	if err := w.Wait(); err == nil || err == ErrHalted {
+		t.Errorf("expected the error of the last attempt, got %v", err)
+	}
+}
+
+func TestIgnoreMetadata(t *testing.T) {
+	events := make(chan fsnotify.Event)
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{t.TempDir()}
+	c.Debounce = 20 * time.Millisecond
+	c.IgnoreMetadata = true
+	c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	halt, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { halt <- struct{}{} }()
+
+	events <- fsnotify.Event{Name: "a", Op: fsnotify.Chmod}
+	select {
+	case cycle := <-cycles:
+		t.Errorf("a metadata change started cycle %+v", cycle)
+	case <-time.After(5 * c.Debounce):
+	}
+	events <- fsnotify.Event{Name: "b", Op: fsnotify.Write | fsnotify.Chmod}
+	if cycle := <-cycles; !slices.Equal(cycle.Paths, []string{"b"}) {
+		t.Errorf("expected a cycle for b, got %+v", cycle)
+	}
+}
+
+func TestInitialScan(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.txt", ".git/x.go", "sub/c.go"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cycles := make(chan Cycle, 1)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Filter = Ext(".go")
+	c.InitialScan = true
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return false
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "sub", "c.go")}
+	cycle := <-cycles
+	if !slices.Equal(cycle.Paths, want) || !slices.Equal(cycle.Changes.Created, want) {
+		t.Errorf("expected %v created, got %+v", want, cycle)
+	}
+}
+
+// BenchmarkEvents measures the work done for each event received while a
+// cycle is debouncing.
+func BenchmarkEvents(b *testing.B) {
+	dir := b.TempDir()
+	names := make([]string, 100)
+	for i := range names {
+		names[i] = filepath.Join(dir, "src", fmt.Sprintf("file%d.go", i))
+	}
+	for _, bench := range []struct {
+		name   string
+		ignore string
+		filter Filter
+	}{
+		{name: "kept", filter: Ext(".go")},
+		{name: "ignored", ignore: "*.go"},
+		{name: "filtered", filter: Ext(".txt")},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			events := make(chan fsnotify.Event)
+			c := DefaultConfig()
+			c.Dirs = []string{dir}
+			c.Debounce = time.Hour
+			if bench.ignore != "" {
+				c.Ignore = append(c.Ignore, bench.ignore)
+			}
+			c.Filter = bench.filter
+			c.NewSource = func() (Source, error) { return fakeSource{events}, nil }
+			c.OnChange = func(context.Context, Cycle) bool { return true }
+			w, err := c.Start()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer w.Halt()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				events <- fsnotify.Event{Name: names[i%len(names)], Op: fsnotify.Write}
+			}
+		})
+	}
+}
+
+func TestWatchOnce(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes, err := WatchOnce(ctx, []string{dir}, 10*time.Millisecond, func(c *Config) {
+		c.OnReady = func(Coverage) {
+			if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o644); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a.txt")}; !slices.Equal(changes.Created, want) {
+		t.Errorf("got created %v, want %v", changes.Created, want)
+	}
+
+	cancel()
+	if _, err := WatchOnce(ctx, []string{dir}, 10*time.Millisecond); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after ctx was done, want %v", err, context.Canceled)
+	}
+}
+
+func TestUntil(t *testing.T) {
+	dir := t.TempDir()
+	flag := filepath.Join(dir, "done.flag")
+	exists := func(ChangeSet) bool {
+		_, err := os.Stat(flag)
+		return err == nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	calls := 0
+	err := Until(ctx, []string{dir}, 10*time.Millisecond, func(s ChangeSet) bool {
+		calls += 1
+		return exists(s)
+	}, func(c *Config) {
+		c.OnReady = func(Coverage) {
+			go func() {
+				if err := os.WriteFile(filepath.Join(dir, "log.txt"), nil, 0o644); err != nil {
+					t.Error(err)
+				}
+				time.Sleep(50 * time.Millisecond)
+				if err := os.WriteFile(flag, nil, 0o644); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls < 3 {
+		t.Errorf("done was called %d times, want at least 3", calls)
+	}
+
+	// The flag exists already, so Until returns without an event.
+	if err := Until(ctx, []string{dir}, 10*time.Millisecond, exists); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := os.WriteFile(a, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cycles := make(chan Cycle, 10)
+	c := DefaultConfig()
+	c.Dirs = []string{dir}
+	c.Debounce = time.Minute // only triggers end cycles
+	c.OnChange = func(_ context.Context, cycle Cycle) bool {
+		cycles <- cycle
+		return true
+	}
+	w, err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Halt()
+
+	next := func() Cycle {
+		t.Helper()
+		select {
+		case cycle := <-cycles:
+			return cycle
+		case <-time.After(time.Second):
+			t.Fatal("no cycle")
+			return Cycle{}
+		}
+	}
+
+	w.Trigger()
+	if cycle := next(); len(cycle.Paths) != 0 {
+		t.Errorf("got paths %v, want none", cycle.Paths)
+	}
+
+	w.Trigger(a)
+	if cycle := next(); !slices.Equal(cycle.Changes.Modified, []string{a}) {
+		t.Errorf("got %+v, want %s modified", cycle.Changes, a)
+	}
+
+	// A trigger ends the debounce of a cycle in progress.
+	if err := os.WriteFile(b, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	w.Trigger(a)
+	cycle := next()
+	if !slices.Equal(cycle.Paths, []string{a, b}) {
+		t.Errorf("got paths %v, want %v", cycle.Paths, []string{a, b})
+	}
+}